@@ -0,0 +1,130 @@
+package runhttp
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const defaultAccessLogSampleRate = 1.0
+
+var defaultAccessLogSkipPaths = []string{"/healthcheck", "/healthcheck/live", "/healthcheck/ready"}
+
+type logAccess struct {
+	Method     string  `logevent:"method"`
+	Route      string  `logevent:"route"`
+	Path       string  `logevent:"path"`
+	Status     int     `logevent:"status"`
+	BytesIn    int64   `logevent:"bytes_in"`
+	BytesOut   int     `logevent:"bytes_out"`
+	DurationMS float64 `logevent:"duration_ms"`
+	RemoteAddr string  `logevent:"remote_addr"`
+	UserAgent  string  `logevent:"user_agent"`
+	RequestID  string  `logevent:"request_id"`
+	Message    string  `logevent:"message,default=access"`
+}
+
+// AccessLogConfig is the container for request access log settings.
+type AccessLogConfig struct {
+	Enabled    bool     `description:"Whether a log event is emitted for each request."`
+	SkipPaths  []string `description:"Request paths that are never logged."`
+	SampleRate float64  `description:"Fraction of successful requests that are logged, from 0 to 1. Requests that fail with a 4xx or 5xx status are always logged."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*AccessLogConfig) Name() string {
+	return "accesslog"
+}
+
+// Description returns the help information for the configuration root.
+func (*AccessLogConfig) Description() string {
+	return "Request access log configuration."
+}
+
+// AccessLog emits one log event for each request through the logger in
+// the request context. Requests for one of the SkipPaths are not logged.
+// Successful requests are logged with a probability of SampleRate while
+// any request that results in a 4xx or 5xx status is always logged.
+type AccessLog struct {
+	SkipPaths  map[string]bool
+	SampleRate float64
+}
+
+// AccessLogComponent implements the settings.Component interface for the
+// access log.
+type AccessLogComponent struct{}
+
+// Settings returns a configuration with all defaults set.
+func (*AccessLogComponent) Settings() *AccessLogConfig {
+	return &AccessLogConfig{
+		Enabled:    true,
+		SkipPaths:  append([]string(nil), defaultAccessLogSkipPaths...),
+		SampleRate: defaultAccessLogSampleRate,
+	}
+}
+
+// New produces an AccessLog bound to the given configuration. The result
+// is nil when the access log is not enabled.
+func (*AccessLogComponent) New(_ context.Context, conf *AccessLogConfig) (*AccessLog, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+	if conf.SampleRate < 0 || conf.SampleRate > 1 {
+		return nil, fmt.Errorf("accesslog samplerate must be between 0 and 1 but was %v", conf.SampleRate)
+	}
+	skip := make(map[string]bool, len(conf.SkipPaths))
+	for _, path := range conf.SkipPaths {
+		skip[path] = true
+	}
+	return &AccessLog{
+		SkipPaths:  skip,
+		SampleRate: conf.SampleRate,
+	}, nil
+}
+
+// Middleware wraps a handler so that its requests are logged.
+func (a *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.SkipPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		body := countBody(r)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := responseStatus(ww)
+		if status < http.StatusBadRequest && !a.sampled() {
+			return
+		}
+		LoggerFromContext(r.Context()).Info(logAccess{
+			Method:     r.Method,
+			Route:      routePattern(r),
+			Path:       r.URL.Path,
+			Status:     status,
+			BytesIn:    body.count.Load(),
+			BytesOut:   ww.BytesWritten(),
+			DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+			RemoteAddr: r.RemoteAddr,
+			UserAgent:  r.UserAgent(),
+			RequestID:  RequestIDFromContext(r.Context()),
+		})
+	})
+}
+
+// sampled reports whether a successful request is logged.
+func (a *AccessLog) sampled() bool {
+	switch {
+	case a.SampleRate >= 1:
+		return true
+	case a.SampleRate <= 0:
+		return false
+	default:
+		return rand.Float64() < a.SampleRate
+	}
+}
@@ -0,0 +1,104 @@
+package runhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	hlog "github.com/asecurityteam/logevent/v2/http"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newAccessLogHandler(t *testing.T, conf *AccessLogConfig, logger Logger) http.Handler {
+	t.Helper()
+	accessLog, err := (&AccessLogComponent{}).New(context.Background(), conf)
+	require.Nil(t, err)
+	router := chi.NewRouter()
+	router.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	})
+	router.Get("/healthcheck", (&HealthCheckHandler{}).Handle)
+	router.Get("/missing", http.NotFound)
+	requestID, err := (&RequestIDComponent{}).New(context.Background(), (&RequestIDComponent{}).Settings())
+	require.Nil(t, err)
+	var handler http.Handler = router
+	handler = accessLog.Middleware(handler)
+	handler = requestID.Middleware(handler)
+	handler = hlog.NewMiddleware(logger)(handler)
+	return withRouteContext(router)(handler)
+}
+
+func TestAccessLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	logger.EXPECT().Copy().Return(logger).AnyTimes()
+	logger.EXPECT().SetField(requestIDLogField, gomock.Any()).AnyTimes()
+	var event logAccess
+	logger.EXPECT().Info(gomock.Any()).Do(func(e interface{}) {
+		event = e.(logAccess)
+	})
+	handler := newAccessLogHandler(t, (&AccessLogComponent{}).Settings(), logger)
+
+	r := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader("payload"))
+	r.Header.Set("User-Agent", "test-agent")
+	r.Header.Set("X-Request-ID", "abc")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Equal(t, http.MethodPost, event.Method)
+	require.Equal(t, "/users/{id}", event.Route)
+	require.Equal(t, "/users/42", event.Path)
+	require.Equal(t, http.StatusCreated, event.Status)
+	require.Equal(t, int64(len("payload")), event.BytesIn)
+	require.Equal(t, len("created"), event.BytesOut)
+	require.Equal(t, r.RemoteAddr, event.RemoteAddr)
+	require.Equal(t, "test-agent", event.UserAgent)
+	require.Equal(t, "abc", event.RequestID)
+
+	// Health checks are skipped by default.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	logger.EXPECT().Copy().Return(logger).AnyTimes()
+	logger.EXPECT().SetField(requestIDLogField, gomock.Any()).AnyTimes()
+	conf := (&AccessLogComponent{}).Settings()
+	conf.SampleRate = 0
+	handler := newAccessLogHandler(t, conf, logger)
+
+	// Successful requests are never sampled but failures are always
+	// logged.
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/42", nil))
+	logger.EXPECT().Info(gomock.Any()).Do(func(e interface{}) {
+		require.Equal(t, http.StatusNotFound, e.(logAccess).Status)
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+}
+
+func TestAccessLogComponent(t *testing.T) {
+	cmp := &AccessLogComponent{}
+	conf := cmp.Settings()
+	conf.Enabled = false
+	accessLog, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.Nil(t, accessLog)
+
+	conf = cmp.Settings()
+	conf.SampleRate = 1.5
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,179 @@
+package runhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultAdminAddress = ":8081"
+
+	// redactedValue replaces credentials in the rendered configuration. It
+	// matches the replacement used by url.URL.Redacted.
+	redactedValue = "xxxxx"
+)
+
+// AdminConfig is the container for the admin server configuration. The
+// admin server accepts every HTTP server setting.
+type AdminConfig struct {
+	Enabled bool `description:"Whether the admin server for operational endpoints is started."`
+	*HTTPConfig
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*AdminConfig) Name() string {
+	return "admin"
+}
+
+// Description returns the help information for the configuration root.
+func (*AdminConfig) Description() string {
+	return "Admin server configuration. The admin server hosts health, debug, metrics, and config endpoints."
+}
+
+// AdminComponent implements the settings.Component interface for the
+// admin server.
+type AdminComponent struct {
+	HTTP    *HTTPComponent
+	Logger  Logger
+	Stat    Stat
+	Handler http.Handler
+}
+
+// NewAdminComponent populates the component with some default values.
+func NewAdminComponent() *AdminComponent {
+	return &AdminComponent{
+		HTTP: NewHTTPComponent(),
+	}
+}
+
+// WithLogger returns a copy of the component that reports certificate
+// reloads to the given logger.
+func (c *AdminComponent) WithLogger(logger Logger) *AdminComponent {
+	n := *c
+	n.Logger = logger
+	return &n
+}
+
+// WithStat returns a copy of the component that reports certificate
+// reloads to the given stat client.
+func (c *AdminComponent) WithStat(stat Stat) *AdminComponent {
+	n := *c
+	n.Stat = stat
+	return &n
+}
+
+// WithHandler returns a copy of the component bound to the given handler.
+func (c *AdminComponent) WithHandler(h http.Handler) *AdminComponent {
+	n := *c
+	n.Handler = h
+	return &n
+}
+
+// Settings returns a configuration with all defaults set.
+func (c *AdminComponent) Settings() *AdminConfig {
+	conf := c.HTTP.Settings()
+	conf.Address = defaultAdminAddress
+	return &AdminConfig{
+		HTTPConfig: conf,
+	}
+}
+
+// New produces the admin server bound to the given configuration. The
+// result is nil when the admin server is not enabled.
+func (c *AdminComponent) New(ctx context.Context, conf *AdminConfig) (*HostedServer, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+	hosted, err := c.HTTP.NewHosted(ctx, conf.HTTPConfig, c.Logger, c.Stat)
+	if err != nil {
+		return nil, err
+	}
+	hosted.Handler = c.Handler
+	return hosted, nil
+}
+
+// NewAdminRouter generates the mux served by the admin server. It hosts
+//
+//	/healthcheck   the same health checks as NewDefaultRouter
+//	/debug/pprof/  the net/http/pprof profiles
+//	/debug/vars    the expvar metrics of the process
+//	/config        the given configuration rendered as JSON
+//
+// The configuration is rendered with the password of any URL and the value
+// of every header replaced by xxxxx so that credentials are not exposed.
+func NewAdminRouter(config interface{}) *chi.Mux {
+	router := chi.NewMux()
+	healthCheckHandler := &HealthCheckHandler{}
+
+	router.Get("/healthcheck", healthCheckHandler.Handle)
+	router.Get("/healthcheck/live", healthCheckHandler.Live)
+	router.Get("/healthcheck/ready", healthCheckHandler.Ready)
+	router.Get("/debug/pprof/cmdline", pprof.Cmdline)
+	router.Get("/debug/pprof/profile", pprof.Profile)
+	router.Get("/debug/pprof/symbol", pprof.Symbol)
+	router.Post("/debug/pprof/symbol", pprof.Symbol)
+	router.Get("/debug/pprof/trace", pprof.Trace)
+	router.Get("/debug/pprof/*", pprof.Index)
+	router.Get("/debug/vars", expvar.Handler().ServeHTTP)
+	router.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		redacted, err := redactConfig(config)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(redacted)
+	})
+
+	return router
+}
+
+// redactConfig converts the configuration to its JSON form with any
+// credentials removed.
+func redactConfig(config interface{}) (interface{}, error) {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var tree interface{}
+	if err = decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return redactValue(tree, false), nil
+}
+
+// redactValue walks a decoded JSON value. Every string within a headers
+// object is replaced and URLs elsewhere keep their user name but not their
+// password.
+func redactValue(value interface{}, header bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = redactValue(child, header || strings.EqualFold(key, "headers"))
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child, header)
+		}
+	case string:
+		if header {
+			return redactedValue
+		}
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+	return value
+}
@@ -0,0 +1,358 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BreakerClosed is the state of a circuit that lets every request
+	// through.
+	BreakerClosed = "closed"
+	// BreakerOpen is the state of a circuit that rejects every request.
+	BreakerOpen = "open"
+	// BreakerHalfOpen is the state of a circuit that lets a limited
+	// number of trial requests through to decide whether to close again.
+	BreakerHalfOpen = "half-open"
+
+	// BreakerHealthCheck is the name of the health check that fails while
+	// any circuit is open.
+	BreakerHealthCheck = "client:breaker"
+
+	statGaugeBreakerState = "http.client.breaker.state"
+
+	defaultBreakerFailureRatio     = 0.5
+	defaultBreakerMinRequests      = 20
+	defaultBreakerWindow           = 10 * time.Second
+	defaultBreakerCoolDown         = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+var defaultBreakerFailureStatusCodes = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// breakerGauge is the value of the state gauge for each state.
+var breakerGauge = map[string]float64{
+	BreakerClosed:   0,
+	BreakerHalfOpen: 1,
+	BreakerOpen:     2,
+}
+
+// ErrCircuitOpen is returned, wrapped with the host, for requests rejected
+// by an open circuit.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type logBreakerStateChanged struct {
+	Host    string `logevent:"host"`
+	From    string `logevent:"from"`
+	To      string `logevent:"to"`
+	Message string `logevent:"message,default=breaker-state-changed"`
+}
+
+// BreakerConfig is the container for outbound circuit breaker settings.
+type BreakerConfig struct {
+	Enabled            bool          `description:"Whether requests to a failing host are rejected without being sent."`
+	FailureRatio       float64       `description:"Fraction of failed requests to a host within a window, from 0 to 1, at which its circuit opens."`
+	MinRequests        int           `description:"Minimum number of requests to a host within a window before its circuit may open."`
+	Window             time.Duration `description:"Duration of the window over which failures are counted."`
+	CoolDown           time.Duration `description:"Duration a circuit stays open before trial requests are let through."`
+	HalfOpenRequests   int           `description:"Number of trial requests that must succeed before a circuit closes again."`
+	FailureStatusCodes []int         `description:"Response statuses counted as failures. Transport errors are always failures."`
+	Readiness          bool          `description:"Whether an open circuit fails the readiness check."`
+	StateGauge         string        `description:"Name of the gauge metric tracking the state of each circuit. Closed is 0, half-open is 1, and open is 2."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*BreakerConfig) Name() string {
+	return "breaker"
+}
+
+// Description returns the help information for the configuration root.
+func (*BreakerConfig) Description() string {
+	return "Outbound circuit breaker configuration."
+}
+
+// newBreakerConfig returns the circuit breaker settings with all defaults
+// set.
+func newBreakerConfig() *BreakerConfig {
+	return &BreakerConfig{
+		FailureRatio:       defaultBreakerFailureRatio,
+		MinRequests:        defaultBreakerMinRequests,
+		Window:             defaultBreakerWindow,
+		CoolDown:           defaultBreakerCoolDown,
+		HalfOpenRequests:   defaultBreakerHalfOpenRequests,
+		FailureStatusCodes: append([]int(nil), defaultBreakerFailureStatusCodes...),
+		StateGauge:         statGaugeBreakerState,
+	}
+}
+
+// newBreakerTransport creates a BreakerTransport from the configuration.
+func newBreakerTransport(base http.RoundTripper, conf *BreakerConfig, logger Logger, stat Stat) (*BreakerTransport, error) {
+	switch {
+	case conf.FailureRatio <= 0 || conf.FailureRatio > 1:
+		return nil, fmt.Errorf("client breaker failureratio must be above 0 and at most 1 but was %g", conf.FailureRatio)
+	case conf.MinRequests < 1:
+		return nil, fmt.Errorf("client breaker minrequests must be positive but was %d", conf.MinRequests)
+	case conf.Window <= 0:
+		return nil, fmt.Errorf("client breaker window must be positive but was %s", conf.Window)
+	case conf.CoolDown <= 0:
+		return nil, fmt.Errorf("client breaker cooldown must be positive but was %s", conf.CoolDown)
+	case conf.HalfOpenRequests < 1:
+		return nil, fmt.Errorf("client breaker halfopenrequests must be positive but was %d", conf.HalfOpenRequests)
+	}
+	transport := &BreakerTransport{
+		Base:               base,
+		Logger:             logger,
+		Stat:               stat,
+		FailureRatio:       conf.FailureRatio,
+		MinRequests:        conf.MinRequests,
+		Window:             conf.Window,
+		CoolDown:           conf.CoolDown,
+		HalfOpenRequests:   conf.HalfOpenRequests,
+		FailureStatusCodes: make(map[int]bool, len(conf.FailureStatusCodes)),
+		StateGaugeName:     conf.StateGauge,
+	}
+	for _, status := range conf.FailureStatusCodes {
+		transport.FailureStatusCodes[status] = true
+	}
+	return transport, nil
+}
+
+// BreakerTransport keeps a circuit for each host so that a failing
+// dependency is given time to recover rather than a growing backlog of
+// requests. A request fails when no response is received or the response
+// has one of the FailureStatusCodes. Requests abandoned by the caller are
+// not counted.
+//
+// A closed circuit opens once at least MinRequests were sent to the host
+// within a Window and the FailureRatio of them failed. An open circuit
+// rejects requests with ErrCircuitOpen until the CoolDown has passed and
+// then becomes half-open. A half-open circuit lets up to HalfOpenRequests
+// trial requests through at a time. It closes once that many succeed and
+// opens again on any failure.
+//
+// Each change of state is logged through the Logger and reported through
+// the Stat as a gauge tagged with the host, if they are set.
+type BreakerTransport struct {
+	Base               http.RoundTripper
+	Logger             Logger
+	Stat               Stat
+	FailureRatio       float64
+	MinRequests        int
+	Window             time.Duration
+	CoolDown           time.Duration
+	HalfOpenRequests   int
+	FailureStatusCodes map[int]bool
+	StateGaugeName     string
+
+	lock     sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of the breaker for a single host. The generation
+// changes with each change of state so that the results of requests
+// admitted under an earlier state are ignored.
+type circuit struct {
+	state       string
+	generation  int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int
+	successes   int
+}
+
+// breakerTransition is a change of state of the circuit of a host.
+type breakerTransition struct {
+	host string
+	from string
+	to   string
+}
+
+// RoundTrip sends the request unless the circuit of its host is open.
+func (t *BreakerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	host := r.URL.Host
+	generation, ok := t.admit(host)
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+	}
+	resp, err := t.base().RoundTrip(r)
+	if err != nil && r.Context().Err() != nil {
+		t.release(host, generation)
+		return resp, err
+	}
+	t.record(host, generation, err == nil && !t.FailureStatusCodes[resp.StatusCode])
+	return resp, err
+}
+
+// State returns the state of the circuit of a host.
+func (t *BreakerTransport) State(host string) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if c, ok := t.circuits[host]; ok {
+		return c.state
+	}
+	return BreakerClosed
+}
+
+// Check fails while the circuit of any host is open. It may be registered
+// as a health check so that an instance stops receiving traffic while it
+// cannot reach its dependencies. Circuits whose CoolDown has passed are
+// made half-open so that an instance that receives no traffic while it
+// fails the check is not kept out of rotation forever.
+func (t *BreakerTransport) Check(_ context.Context) error {
+	now := time.Now()
+	var transitions []*breakerTransition
+	var open []string
+	t.lock.Lock()
+	for host, c := range t.circuits {
+		if c.state != BreakerOpen {
+			continue
+		}
+		if now.Sub(c.openedAt) >= t.CoolDown {
+			transitions = append(transitions, t.transition(host, c, BreakerHalfOpen, now))
+			continue
+		}
+		open = append(open, host)
+	}
+	t.lock.Unlock()
+	for _, transition := range transitions {
+		t.report(transition)
+	}
+	if len(open) > 0 {
+		sort.Strings(open)
+		return fmt.Errorf("%w for %s", ErrCircuitOpen, strings.Join(open, ", "))
+	}
+	return nil
+}
+
+// admit decides whether a request may be sent to the host.
+func (t *BreakerTransport) admit(host string) (int, bool) {
+	now := time.Now()
+	var transition *breakerTransition
+	defer func() { t.report(transition) }()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c := t.circuit(host, now)
+	switch c.state {
+	case BreakerOpen:
+		if now.Sub(c.openedAt) < t.CoolDown {
+			return c.generation, false
+		}
+		transition = t.transition(host, c, BreakerHalfOpen, now)
+		fallthrough
+	case BreakerHalfOpen:
+		if c.trials >= t.HalfOpenRequests {
+			return c.generation, false
+		}
+		c.trials++
+	default:
+		if now.Sub(c.windowStart) >= t.Window {
+			c.windowStart, c.requests, c.failures = now, 0, 0
+		}
+	}
+	return c.generation, true
+}
+
+// record counts the result of a request admitted under the generation.
+func (t *BreakerTransport) record(host string, generation int, success bool) {
+	now := time.Now()
+	var transition *breakerTransition
+	defer func() { t.report(transition) }()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c := t.circuit(host, now)
+	if c.generation != generation {
+		return
+	}
+	switch c.state {
+	case BreakerHalfOpen:
+		c.trials--
+		if !success {
+			transition = t.transition(host, c, BreakerOpen, now)
+			return
+		}
+		c.successes++
+		if c.successes >= t.HalfOpenRequests {
+			transition = t.transition(host, c, BreakerClosed, now)
+		}
+	case BreakerClosed:
+		c.requests++
+		if !success {
+			c.failures++
+		}
+		if c.requests >= t.MinRequests && float64(c.failures) >= t.FailureRatio*float64(c.requests) {
+			transition = t.transition(host, c, BreakerOpen, now)
+		}
+	}
+}
+
+// release returns the trial slot of a request that was abandoned.
+func (t *BreakerTransport) release(host string, generation int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	c := t.circuit(host, time.Now())
+	if c.generation == generation && c.state == BreakerHalfOpen {
+		c.trials--
+	}
+}
+
+// circuit returns the circuit of a host, creating a closed one if there is
+// none. The lock must be held.
+func (t *BreakerTransport) circuit(host string, now time.Time) *circuit {
+	if t.circuits == nil {
+		t.circuits = make(map[string]*circuit)
+	}
+	c, ok := t.circuits[host]
+	if !ok {
+		c = &circuit{state: BreakerClosed, windowStart: now}
+		t.circuits[host] = c
+	}
+	return c
+}
+
+// transition moves a circuit to a new state. The lock must be held.
+func (t *BreakerTransport) transition(host string, c *circuit, to string, now time.Time) *breakerTransition {
+	from := c.state
+	*c = circuit{
+		state:       to,
+		generation:  c.generation + 1,
+		windowStart: now,
+		openedAt:    c.openedAt,
+	}
+	if to == BreakerOpen {
+		c.openedAt = now
+	}
+	return &breakerTransition{host: host, from: from, to: to}
+}
+
+// report emits the log event and gauge for a change of state.
+func (t *BreakerTransport) report(transition *breakerTransition) {
+	if transition == nil {
+		return
+	}
+	if t.Logger != nil {
+		t.Logger.Warn(logBreakerStateChanged{Host: transition.host, From: transition.from, To: transition.to})
+	}
+	if t.Stat != nil {
+		t.Stat.Gauge(t.StateGaugeName, breakerGauge[transition.to], "host:"+transition.host)
+	}
+}
+
+func (t *BreakerTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
@@ -0,0 +1,235 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+const testBreakerHost = "users.internal"
+
+// stubTransport responds with the next status, or fails when the status
+// is zero.
+type stubTransport struct {
+	statuses chan int
+}
+
+func (s *stubTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	select {
+	case status := <-s.statuses:
+		if status == 0 {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: r}, nil
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+}
+
+func newTestBreaker(t *testing.T, logger Logger, stat Stat, modify func(*BreakerConfig)) (*BreakerTransport, *stubTransport) {
+	t.Helper()
+	conf := newBreakerConfig()
+	conf.MinRequests = 4
+	conf.Window = time.Minute
+	conf.CoolDown = 50 * time.Millisecond
+	if modify != nil {
+		modify(conf)
+	}
+	stub := &stubTransport{statuses: make(chan int, 16)}
+	breaker, err := newBreakerTransport(stub, conf, logger, stat)
+	require.Nil(t, err)
+	return breaker, stub
+}
+
+func sendThroughBreaker(t *testing.T, breaker *BreakerTransport, stub *stubTransport, status int) error {
+	t.Helper()
+	stub.statuses <- status
+	_, err := breaker.RoundTrip(httptest.NewRequest(http.MethodGet, "http://"+testBreakerHost+"/users", nil))
+	if errors.Is(err, ErrCircuitOpen) {
+		<-stub.statuses
+	}
+	return err
+}
+
+func expectBreakerTransition(logger *MockLogger, stat *MockStat, from string, to string) *gomock.Call {
+	logger.EXPECT().Warn(logBreakerStateChanged{Host: testBreakerHost, From: from, To: to})
+	return stat.EXPECT().Gauge(statGaugeBreakerState, breakerGauge[to], "host:"+testBreakerHost)
+}
+
+func TestBreakerTransport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	breaker, stub := newTestBreaker(t, logger, stat, nil)
+
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusOK))
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusNotFound))
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusServiceUnavailable))
+	require.Equal(t, BreakerClosed, breaker.State(testBreakerHost))
+	require.Nil(t, breaker.Check(context.Background()))
+
+	expectBreakerTransition(logger, stat, BreakerClosed, BreakerOpen)
+	require.NotNil(t, sendThroughBreaker(t, breaker, stub, 0))
+	require.Equal(t, BreakerOpen, breaker.State(testBreakerHost))
+	err := sendThroughBreaker(t, breaker, stub, http.StatusOK)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.Contains(t, err.Error(), testBreakerHost)
+	require.True(t, errors.Is(breaker.Check(context.Background()), ErrCircuitOpen))
+
+	time.Sleep(60 * time.Millisecond)
+	gomock.InOrder(
+		expectBreakerTransition(logger, stat, BreakerOpen, BreakerHalfOpen),
+		expectBreakerTransition(logger, stat, BreakerHalfOpen, BreakerClosed),
+	)
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusOK))
+	require.Equal(t, BreakerClosed, breaker.State(testBreakerHost))
+	require.Nil(t, breaker.Check(context.Background()))
+}
+
+func TestBreakerTransportHalfOpenFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	breaker, stub := newTestBreaker(t, logger, stat, func(c *BreakerConfig) { c.MinRequests = 1 })
+
+	expectBreakerTransition(logger, stat, BreakerClosed, BreakerOpen)
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusBadGateway))
+	require.Equal(t, BreakerOpen, breaker.State(testBreakerHost))
+	time.Sleep(60 * time.Millisecond)
+
+	// Only one trial request is let through at a time.
+	expectBreakerTransition(logger, stat, BreakerOpen, BreakerHalfOpen)
+	done := make(chan error, 1)
+	go func() {
+		_, err := breaker.RoundTrip(httptest.NewRequest(http.MethodGet, "http://"+testBreakerHost+"/users", nil))
+		done <- err
+	}()
+	require.Eventually(t, func() bool {
+		return breaker.State(testBreakerHost) == BreakerHalfOpen
+	}, time.Second, time.Millisecond)
+	_, err := breaker.RoundTrip(httptest.NewRequest(http.MethodGet, "http://"+testBreakerHost+"/users", nil))
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+
+	expectBreakerTransition(logger, stat, BreakerHalfOpen, BreakerOpen)
+	stub.statuses <- 0
+	require.NotNil(t, <-done)
+	require.Equal(t, BreakerOpen, breaker.State(testBreakerHost))
+}
+
+func TestBreakerTransportCheckRecovers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	breaker, stub := newTestBreaker(t, logger, stat, func(c *BreakerConfig) { c.MinRequests = 1 })
+
+	expectBreakerTransition(logger, stat, BreakerClosed, BreakerOpen)
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusBadGateway))
+	require.True(t, errors.Is(breaker.Check(context.Background()), ErrCircuitOpen))
+
+	// The check passes once the cool down has passed without any traffic.
+	time.Sleep(60 * time.Millisecond)
+	expectBreakerTransition(logger, stat, BreakerOpen, BreakerHalfOpen)
+	require.Nil(t, breaker.Check(context.Background()))
+	require.Equal(t, BreakerHalfOpen, breaker.State(testBreakerHost))
+
+	expectBreakerTransition(logger, stat, BreakerHalfOpen, BreakerClosed)
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusOK))
+	require.Equal(t, BreakerClosed, breaker.State(testBreakerHost))
+}
+
+func TestBreakerTransportHedgedTrial(t *testing.T) {
+	breaker, stub := newTestBreaker(t, nil, nil, func(c *BreakerConfig) { c.MinRequests = 1 })
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusBadGateway))
+	require.Equal(t, BreakerOpen, breaker.State(testBreakerHost))
+	time.Sleep(60 * time.Millisecond)
+
+	// The hedge of the trial request is rejected while the circuit is
+	// half-open, which must not cancel the trial.
+	conf := newRetryConfig()
+	conf.MaxAttempts = 1
+	conf.HedgeDelay = 10 * time.Millisecond
+	retry, err := newRetryTransport(breaker, conf)
+	require.Nil(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stub.statuses <- http.StatusOK
+	}()
+	resp, err := retry.RoundTrip(httptest.NewRequest(http.MethodGet, "http://"+testBreakerHost+"/users", nil))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, BreakerClosed, breaker.State(testBreakerHost))
+}
+
+func TestBreakerTransportWindow(t *testing.T) {
+	breaker, stub := newTestBreaker(t, nil, nil, func(c *BreakerConfig) {
+		c.MinRequests = 2
+		c.Window = 20 * time.Millisecond
+	})
+	require.NotNil(t, sendThroughBreaker(t, breaker, stub, 0))
+	time.Sleep(30 * time.Millisecond)
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusOK))
+	require.Nil(t, sendThroughBreaker(t, breaker, stub, http.StatusOK))
+	require.Equal(t, BreakerClosed, breaker.State(testBreakerHost))
+}
+
+func TestBreakerTransportCancelled(t *testing.T) {
+	breaker, _ := newTestBreaker(t, nil, nil, func(c *BreakerConfig) { c.MinRequests = 1 })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "http://"+testBreakerHost+"/users", nil).WithContext(ctx)
+	_, err := breaker.RoundTrip(req)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Equal(t, BreakerClosed, breaker.State(testBreakerHost))
+}
+
+func TestBreakerConfigInvalid(t *testing.T) {
+	tc := []struct {
+		name   string
+		modify func(*BreakerConfig)
+	}{
+		{name: "zero failure ratio", modify: func(c *BreakerConfig) { c.FailureRatio = 0 }},
+		{name: "failure ratio above one", modify: func(c *BreakerConfig) { c.FailureRatio = 1.5 }},
+		{name: "zero min requests", modify: func(c *BreakerConfig) { c.MinRequests = 0 }},
+		{name: "zero window", modify: func(c *BreakerConfig) { c.Window = 0 }},
+		{name: "zero cool down", modify: func(c *BreakerConfig) { c.CoolDown = 0 }},
+		{name: "zero half open requests", modify: func(c *BreakerConfig) { c.HalfOpenRequests = 0 }},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			cmp := &ClientComponent{}
+			conf := cmp.Settings()
+			conf.Breaker.Enabled = true
+			tt.modify(conf.Breaker)
+			_, err := cmp.New(context.Background(), conf)
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestRuntimeClientBreaker(t *testing.T) {
+	rt := newTestRuntime(t)
+	_, ok := rt.Client.Transport.(*RetryTransport).Base.(*ClientTransport).Base.(*http.Transport)
+	require.True(t, ok, "the breaker is disabled by default")
+
+	rt = newTestRuntime(t,
+		"RUNTIME_CLIENT_BREAKER_ENABLED=true",
+		"RUNTIME_CLIENT_BREAKER_READINESS=true",
+	)
+	breaker, ok := rt.Client.Transport.(*RetryTransport).Base.(*ClientTransport).Base.(*BreakerTransport)
+	require.True(t, ok)
+	require.NotNil(t, breaker.Logger)
+	require.NotNil(t, breaker.Stat)
+	report := rt.Health.Ready(context.Background())
+	require.Equal(t, HealthPass, report.Checks[BreakerHealthCheck].Status)
+	require.True(t, report.Checks[BreakerHealthCheck].Critical)
+}
@@ -0,0 +1,149 @@
+package runhttp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statCounterCertificateReload        = "http.server.tls.reload"
+	statCounterCertificateReloadFailure = "http.server.tls.reload.failure"
+	defaultCertificateReloadInterval    = time.Minute
+)
+
+type logCertificateReloaded struct {
+	CertFile string `logevent:"cert_file"`
+	KeyFile  string `logevent:"key_file"`
+	Message  string `logevent:"message,default=tls-certificate-reloaded"`
+}
+
+type logCertificateReloadFailed struct {
+	CertFile string `logevent:"cert_file"`
+	KeyFile  string `logevent:"key_file"`
+	Reason   string `logevent:"reason"`
+	Message  string `logevent:"message,default=tls-certificate-reload-failed"`
+}
+
+// CertificateManager serves a TLS key pair from disk and polls the files
+// for changes. The served certificate is swapped atomically when a new,
+// valid pair is found. The last good pair continues to be served if the
+// files on disk cannot be loaded.
+type CertificateManager struct {
+	Logger                  Logger
+	Stat                    Stat
+	CertFile                string
+	KeyFile                 string
+	Interval                time.Duration
+	ReloadCounterName       string
+	ReloadFailedCounterName string
+	current                 atomic.Pointer[tls.Certificate]
+	lastCert                []byte
+	lastKey                 []byte
+	reloadMut               *sync.Mutex
+	stopCh                  chan interface{}
+	stopped                 sync.Once
+}
+
+// NewCertificateManager loads the key pair named in the configuration. An
+// error is returned if the initial pair cannot be loaded.
+func NewCertificateManager(conf *TLSConfig, logger Logger, stat Stat) (*CertificateManager, error) {
+	m := &CertificateManager{
+		Logger:                  logger,
+		Stat:                    stat,
+		CertFile:                conf.CertFile,
+		KeyFile:                 conf.KeyFile,
+		Interval:                conf.ReloadInterval,
+		ReloadCounterName:       conf.ReloadCounter,
+		ReloadFailedCounterName: conf.ReloadFailedCounter,
+		reloadMut:               &sync.Mutex{},
+		stopCh:                  make(chan interface{}),
+	}
+	changed, err := m.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls key pair: %s", err.Error())
+	}
+	if !changed {
+		return nil, fmt.Errorf("failed to load tls key pair from %s", conf.CertFile)
+	}
+	return m, nil
+}
+
+// GetCertificate implements the tls.Config.GetCertificate hook.
+func (m *CertificateManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.current.Load(), nil
+}
+
+// Watch loops on a time interval and reloads the key pair when the files
+// change. It returns immediately if the Interval is not positive.
+func (m *CertificateManager) Watch() {
+	if m.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = m.Reload()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// Close the watch loop. Close may be called more than once.
+func (m *CertificateManager) Close() error {
+	m.stopped.Do(func() {
+		close(m.stopCh)
+	})
+	return nil
+}
+
+// Reload checks the files on disk and swaps the served certificate if they
+// contain a new, valid key pair. Each reload, and each failed attempt, is
+// logged and counted. Unchanged files are ignored.
+func (m *CertificateManager) Reload() error {
+	changed, err := m.load()
+	if err != nil {
+		m.Stat.Count(m.ReloadFailedCounterName, 1)
+		m.Logger.Error(logCertificateReloadFailed{CertFile: m.CertFile, KeyFile: m.KeyFile, Reason: err.Error()})
+		return err
+	}
+	if changed {
+		m.Stat.Count(m.ReloadCounterName, 1)
+		m.Logger.Info(logCertificateReloaded{CertFile: m.CertFile, KeyFile: m.KeyFile})
+	}
+	return nil
+}
+
+// load reads the key pair and reports whether a new certificate was
+// installed. Content that matches the previous attempt, successful or not,
+// is skipped so that a bad pair is only reported once.
+func (m *CertificateManager) load() (bool, error) {
+	m.reloadMut.Lock()
+	defer m.reloadMut.Unlock()
+	certPEM, err := os.ReadFile(m.CertFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(m.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(certPEM, m.lastCert) && bytes.Equal(keyPEM, m.lastKey) {
+		return false, nil
+	}
+	m.lastCert = certPEM
+	m.lastKey = keyPEM
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	m.current.Store(&cert)
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package runhttp
+
+import (
+	"crypto/x509"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func servedLeaf(t *testing.T, m *CertificateManager) *x509.Certificate {
+	t.Helper()
+	cert, err := m.GetCertificate(nil)
+	require.Nil(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.Nil(t, err)
+	return leaf
+}
+
+func TestCertificateManagerReload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	dir := t.TempDir()
+	first := newTestCert(t, dir, "server", nil)
+
+	conf := (&TLSComponent{}).Settings()
+	conf.CertFile = first.CertFile
+	conf.KeyFile = first.KeyFile
+	m, err := NewCertificateManager(conf, logger, stat)
+	require.Nil(t, err)
+	require.Equal(t, first.Cert.SerialNumber, servedLeaf(t, m).SerialNumber)
+
+	// Unchanged files are not reported.
+	require.Nil(t, m.Reload())
+
+	// A rotated pair is swapped in.
+	second := newTestCert(t, dir, "server", nil)
+	stat.EXPECT().Count(conf.ReloadCounter, float64(1))
+	logger.EXPECT().Info(gomock.Any())
+	require.Nil(t, m.Reload())
+	require.Equal(t, second.Cert.SerialNumber, servedLeaf(t, m).SerialNumber)
+
+	// A broken pair is reported once and the last good pair is kept.
+	require.Nil(t, os.WriteFile(second.KeyFile, []byte("not a key"), 0600))
+	stat.EXPECT().Count(conf.ReloadFailedCounter, float64(1))
+	logger.EXPECT().Error(gomock.Any())
+	require.NotNil(t, m.Reload())
+	require.Nil(t, m.Reload())
+	require.Equal(t, second.Cert.SerialNumber, servedLeaf(t, m).SerialNumber)
+}
+
+func TestCertificateManagerInitialFailure(t *testing.T) {
+	dir := t.TempDir()
+	conf := (&TLSComponent{}).Settings()
+	conf.CertFile = dir + "/missing.crt"
+	conf.KeyFile = dir + "/missing.key"
+	_, err := NewCertificateManager(conf, nil, nil)
+	require.NotNil(t, err)
+}
+
+func TestCertificateManagerWatch(t *testing.T) {
+	dir := t.TempDir()
+	pair := newTestCert(t, dir, "server", nil)
+	conf := (&TLSComponent{}).Settings()
+	conf.CertFile = pair.CertFile
+	conf.KeyFile = pair.KeyFile
+	m, err := NewCertificateManager(conf, nil, nil)
+	require.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		m.Watch()
+		close(done)
+	}()
+	require.Nil(t, m.Close())
+	require.Nil(t, m.Close())
+	<-done
+
+	// A manager without an interval never reloads.
+	m, err = NewCertificateManager(conf, nil, nil)
+	require.Nil(t, err)
+	m.Interval = 0
+	m.Watch()
+	require.Nil(t, m.Close())
+}
@@ -0,0 +1,182 @@
+package runhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultHTTPCheckMinStatus = http.StatusOK
+	defaultHTTPCheckMaxStatus = 399
+)
+
+// Pinger is implemented by clients that can verify their connection, such
+// as *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingCheck creates a check that passes when the Pinger does.
+func PingCheck(p Pinger) HealthCheckFn {
+	return p.PingContext
+}
+
+// TCPCheck creates a check that passes when a TCP connection to the
+// host:port address can be established.
+func TCPCheck(address string) HealthCheckFn {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPCheck creates a check that sends a GET request to the URL and passes
+// when the response status is within the inclusive range from minStatus to
+// maxStatus. The default client is used when client is nil.
+func HTTPCheck(client *http.Client, url string, minStatus int, maxStatus int) HealthCheckFn {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < minStatus || resp.StatusCode > maxStatus {
+			return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+		}
+		return nil
+	}
+}
+
+// DNSCheck creates a check that passes when the host resolves to at least
+// one address. The default resolver is used when resolver is nil.
+func DNSCheck(resolver *net.Resolver, host string) HealthCheckFn {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return func(ctx context.Context) error {
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return err
+		}
+		if len(addrs) < 1 {
+			return fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil
+	}
+}
+
+// CheckConfig contains the settings shared by every configured check.
+type CheckConfig struct {
+	Critical  bool          `description:"Whether a failure of the checks marks the service as not ready."`
+	Timeout   time.Duration `description:"Maximum duration of each check. Zero uses the default of five seconds."`
+	Interval  time.Duration `description:"Interval on which the checks run in the background. Zero runs the checks on each probe."`
+	Staleness time.Duration `description:"Age after which the result of a background check is failed. Zero uses three intervals."`
+}
+
+// healthCheck creates a check from the shared settings.
+func (c *CheckConfig) healthCheck(name string, check HealthCheckFn) HealthCheck {
+	return HealthCheck{
+		Name:      name,
+		Check:     check,
+		Critical:  c.Critical,
+		Timeout:   c.Timeout,
+		Interval:  c.Interval,
+		Staleness: c.Staleness,
+	}
+}
+
+// TCPCheckConfig declares TCP dial checks.
+type TCPCheckConfig struct {
+	Addresses []string `description:"The host:port addresses that must accept TCP connections."`
+	*CheckConfig
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*TCPCheckConfig) Name() string {
+	return "tcp"
+}
+
+// Description returns the help information for the configuration root.
+func (*TCPCheckConfig) Description() string {
+	return "TCP dial health checks. Each check is named tcp:<address>."
+}
+
+// HTTPCheckConfig declares HTTP GET checks.
+type HTTPCheckConfig struct {
+	URLs      []string `description:"The URLs that must respond to a GET request with an expected status."`
+	MinStatus int      `description:"The lowest expected response status."`
+	MaxStatus int      `description:"The highest expected response status."`
+	*CheckConfig
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*HTTPCheckConfig) Name() string {
+	return "http"
+}
+
+// Description returns the help information for the configuration root.
+func (*HTTPCheckConfig) Description() string {
+	return "HTTP health checks. Each check is named http:<url>."
+}
+
+// DNSCheckConfig declares DNS resolution checks.
+type DNSCheckConfig struct {
+	Hosts []string `description:"The hostnames that must resolve to at least one address."`
+	*CheckConfig
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*DNSCheckConfig) Name() string {
+	return "dns"
+}
+
+// Description returns the help information for the configuration root.
+func (*DNSCheckConfig) Description() string {
+	return "DNS health checks. Each check is named dns:<host>."
+}
+
+// newCheckConfig returns the shared check settings with all defaults set.
+func newCheckConfig() *CheckConfig {
+	return &CheckConfig{
+		Critical: true,
+	}
+}
+
+// configuredChecks creates the checks declared in the configuration.
+func configuredChecks(conf *HealthConfig) ([]HealthCheck, error) {
+	var checks []HealthCheck
+	for _, address := range conf.TCP.Addresses {
+		checks = append(checks, conf.TCP.healthCheck("tcp:"+address, TCPCheck(address)))
+	}
+	if len(conf.HTTP.URLs) > 0 && conf.HTTP.MinStatus > conf.HTTP.MaxStatus {
+		return nil, fmt.Errorf(
+			"health http minstatus %d must not exceed maxstatus %d",
+			conf.HTTP.MinStatus, conf.HTTP.MaxStatus,
+		)
+	}
+	for _, url := range conf.HTTP.URLs {
+		checks = append(checks, conf.HTTP.healthCheck(
+			"http:"+url, HTTPCheck(nil, url, conf.HTTP.MinStatus, conf.HTTP.MaxStatus),
+		))
+	}
+	for _, host := range conf.DNS.Hosts {
+		checks = append(checks, conf.DNS.healthCheck("dns:"+host, DNSCheck(nil, host)))
+	}
+	return checks, nil
+}
@@ -0,0 +1,90 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (p fakePinger) PingContext(context.Context) error {
+	return p.err
+}
+
+func TestPingCheck(t *testing.T) {
+	require.Nil(t, PingCheck(fakePinger{})(context.Background()))
+	require.NotNil(t, PingCheck(fakePinger{err: errors.New("closed")})(context.Background()))
+}
+
+func TestTCPCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	address := l.Addr().String()
+	require.Nil(t, TCPCheck(address)(context.Background()))
+	require.Nil(t, l.Close())
+	require.NotNil(t, TCPCheck(address)(context.Background()))
+}
+
+func TestHTTPCheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	check := HTTPCheck(srv.Client(), srv.URL, 200, 299)
+	require.Nil(t, check(context.Background()))
+	status = http.StatusServiceUnavailable
+	require.NotNil(t, check(context.Background()))
+	status = http.StatusFound
+	require.NotNil(t, check(context.Background()))
+	require.Nil(t, HTTPCheck(nil, srv.URL, 200, 399)(context.Background()))
+}
+
+func TestDNSCheck(t *testing.T) {
+	require.Nil(t, DNSCheck(nil, "localhost")(context.Background()))
+	require.NotNil(t, DNSCheck(nil, "runhttp.invalid")(context.Background()))
+}
+
+func TestHealthComponentConfiguredChecks(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	rt := newTestRuntime(t,
+		"RUNTIME_HEALTH_TCP_ADDRESSES="+l.Addr().String(),
+		"RUNTIME_HEALTH_HTTP_URLS="+srv.URL,
+		"RUNTIME_HEALTH_HTTP_MINSTATUS=404",
+		"RUNTIME_HEALTH_HTTP_MAXSTATUS=404",
+		"RUNTIME_HEALTH_DNS_HOSTS=localhost runhttp.invalid",
+		"RUNTIME_HEALTH_DNS_CRITICAL=false",
+	)
+	report := rt.Health.Ready(context.Background())
+	require.Len(t, report.Checks, 4)
+	require.Equal(t, HealthPass, report.Checks["tcp:"+l.Addr().String()].Status)
+	require.True(t, report.Checks["tcp:"+l.Addr().String()].Critical)
+	require.Equal(t, HealthPass, report.Checks["http:"+srv.URL].Status)
+	require.Equal(t, HealthPass, report.Checks["dns:localhost"].Status)
+	require.Equal(t, HealthFail, report.Checks["dns:runhttp.invalid"].Status)
+	require.False(t, report.Checks["dns:runhttp.invalid"].Critical)
+	require.Equal(t, HealthWarn, report.Status)
+}
+
+func TestHealthComponentInvalidStatusRange(t *testing.T) {
+	cmp := &HealthComponent{}
+	conf := cmp.Settings()
+	conf.HTTP.URLs = []string{"http://localhost"}
+	conf.HTTP.MinStatus = 500
+	conf.HTTP.MaxStatus = 200
+	_, err := cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
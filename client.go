@@ -0,0 +1,282 @@
+package runhttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/xstats"
+)
+
+const (
+	statCounterClientRequest = "http.client.request"
+	statTimerClientRequest   = "http.client.request.latency"
+
+	defaultClientTimeout             = 30 * time.Second
+	defaultClientDialTimeout         = 5 * time.Second
+	defaultClientKeepAlive           = 30 * time.Second
+	defaultClientTLSHandshakeTimeout = 10 * time.Second
+	defaultClientIdleConnTimeout     = 90 * time.Second
+	defaultClientMaxIdleConns        = 100
+	defaultClientMaxIdleConnsPerHost = 10
+)
+
+// nopStat is the stat client returned by StatFromContext for a context
+// without one.
+var nopStat = xstats.FromContext(context.Background())
+
+type logOutboundRequest struct {
+	Method     string  `logevent:"method"`
+	Host       string  `logevent:"host"`
+	Path       string  `logevent:"path"`
+	Status     int     `logevent:"status"`
+	DurationMS float64 `logevent:"duration_ms"`
+	Reason     string  `logevent:"reason"`
+	Message    string  `logevent:"message,default=outbound-request"`
+}
+
+// ClientConfig is the container for outbound HTTP client settings.
+type ClientConfig struct {
+	Timeout               time.Duration `description:"Maximum duration of an outbound request, including reading the response body. Zero disables the timeout."`
+	DialTimeout           time.Duration `description:"Maximum duration for establishing a connection."`
+	TLSHandshakeTimeout   time.Duration `description:"Maximum duration of a TLS handshake."`
+	ResponseHeaderTimeout time.Duration `description:"Maximum duration to wait for the response headers once the request is sent. Zero disables the timeout."`
+	IdleConnTimeout       time.Duration `description:"Maximum duration an idle connection is kept open."`
+	MaxIdleConns          int           `description:"Maximum number of idle connections across all hosts. Zero is unlimited."`
+	MaxIdleConnsPerHost   int           `description:"Maximum number of idle connections to each host."`
+	MaxConnsPerHost       int           `description:"Maximum number of connections to each host, including those in use. Zero is unlimited."`
+	Proxy                 string        `description:"URL of the proxy used for every outbound request. Empty uses the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables."`
+	RequestCounter        string        `description:"Name of the counter metric tracking outbound requests."`
+	LatencyTimer          string        `description:"Name of the timing metric tracking the latency of outbound requests."`
+	Retry                 *RetryConfig
+	Breaker               *BreakerConfig
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*ClientConfig) Name() string {
+	return "client"
+}
+
+// Description returns the help information for the configuration root.
+func (*ClientConfig) Description() string {
+	return "Outbound HTTP client configuration."
+}
+
+// ClientComponent implements the settings.Component interface for the
+// outbound HTTP client. Changes of state of the circuit breaker, and
+// outbound requests whose context has no logger or stat client, are
+// reported through the Logger and Stat. The readiness check of the circuit
+// breaker is registered with the Health registry when one is set.
+type ClientComponent struct {
+	RequestIDHeader string
+	Logger          Logger
+	Stat            Stat
+	Health          *HealthRegistry
+}
+
+// WithRequestIDHeader returns a copy of the component that sends the ID of
+// the request being served in the given header.
+func (c *ClientComponent) WithRequestIDHeader(header string) *ClientComponent {
+	n := *c
+	n.RequestIDHeader = header
+	return &n
+}
+
+// WithLogger returns a copy of the component that logs changes of state of
+// the circuit breaker, and requests without a logger in their context, to
+// the given logger.
+func (c *ClientComponent) WithLogger(logger Logger) *ClientComponent {
+	n := *c
+	n.Logger = logger
+	return &n
+}
+
+// WithStat returns a copy of the component that reports the state of the
+// circuit breaker, and requests without a stat client in their context, to
+// the given stat client.
+func (c *ClientComponent) WithStat(stat Stat) *ClientComponent {
+	n := *c
+	n.Stat = stat
+	return &n
+}
+
+// WithHealth returns a copy of the component that registers the readiness
+// check of the circuit breaker with the given registry.
+func (c *ClientComponent) WithHealth(health *HealthRegistry) *ClientComponent {
+	n := *c
+	n.Health = health
+	return &n
+}
+
+// Settings returns a configuration with all defaults set.
+func (*ClientComponent) Settings() *ClientConfig {
+	return &ClientConfig{
+		Timeout:             defaultClientTimeout,
+		DialTimeout:         defaultClientDialTimeout,
+		TLSHandshakeTimeout: defaultClientTLSHandshakeTimeout,
+		IdleConnTimeout:     defaultClientIdleConnTimeout,
+		MaxIdleConns:        defaultClientMaxIdleConns,
+		MaxIdleConnsPerHost: defaultClientMaxIdleConnsPerHost,
+		RequestCounter:      statCounterClientRequest,
+		LatencyTimer:        statTimerClientRequest,
+		Retry:               newRetryConfig(),
+		Breaker:             newBreakerConfig(),
+	}
+}
+
+// New produces an outbound HTTP client bound to the given configuration.
+// Each attempt of a retried request is logged and measured on its own.
+func (c *ClientComponent) New(_ context.Context, conf *ClientConfig) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if conf.Proxy != "" {
+		proxyURL, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("client proxy %s is not a valid URL: %w", conf.Proxy, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	dialer := &net.Dialer{
+		Timeout:   conf.DialTimeout,
+		KeepAlive: defaultClientKeepAlive,
+	}
+	base := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   conf.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: conf.ResponseHeaderTimeout,
+		IdleConnTimeout:       conf.IdleConnTimeout,
+		MaxIdleConns:          conf.MaxIdleConns,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.MaxConnsPerHost,
+	}
+	var transport http.RoundTripper = base
+	if conf.Breaker.Enabled {
+		breaker, err := newBreakerTransport(base, conf.Breaker, c.Logger, c.Stat)
+		if err != nil {
+			return nil, err
+		}
+		if conf.Breaker.Readiness && c.Health != nil {
+			err = c.Health.Register(HealthCheck{
+				Name:     BreakerHealthCheck,
+				Check:    breaker.Check,
+				Critical: true,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		transport = breaker
+	}
+	retry, err := newRetryTransport(&ClientTransport{
+		Base:               transport,
+		Logger:             c.Logger,
+		Stat:               c.Stat,
+		RequestIDHeader:    c.RequestIDHeader,
+		RequestCounterName: conf.RequestCounter,
+		LatencyTimerName:   conf.LatencyTimer,
+	}, conf.Retry)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   conf.Timeout,
+		Transport: retry,
+	}, nil
+}
+
+// ClientTransport carries the context of the request being served to the
+// outbound requests made on its behalf. The ID of the request is sent in
+// the RequestIDHeader, if set, and the trace context in the traceparent
+// and tracestate headers. Headers already present on the outbound request
+// are not replaced.
+//
+// Each outbound request is logged through the logger in its context and is
+// counted and timed through the stat client in its context, tagged with
+// the host, the method, and the status class or status:error if no
+// response was received. Non-standard methods are tagged as other. The
+// Logger and Stat are used instead for requests whose context has none,
+// such as those made by background jobs. Requests without either are not
+// logged. The Base transport is used to send the request,
+// or the default transport when it is nil.
+type ClientTransport struct {
+	Base               http.RoundTripper
+	Logger             Logger
+	Stat               Stat
+	RequestIDHeader    string
+	RequestCounterName string
+	LatencyTimerName   string
+}
+
+// RoundTrip sends the request.
+func (t *ClientTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	r = r.Clone(ctx)
+	if id := RequestIDFromContext(ctx); id != "" && t.RequestIDHeader != "" && r.Header.Get(t.RequestIDHeader) == "" {
+		r.Header.Set(t.RequestIDHeader, id)
+	}
+	if r.Header.Get(headerTraceParent) == "" {
+		InjectTrace(ctx, r.Header)
+	}
+
+	start := time.Now()
+	resp, err := t.base().RoundTrip(r)
+	duration := time.Since(start)
+
+	event := logOutboundRequest{
+		Method:     r.Method,
+		Host:       r.URL.Host,
+		Path:       r.URL.Path,
+		DurationMS: float64(duration) / float64(time.Millisecond),
+	}
+	logger := t.logger(ctx)
+	status := "status:error"
+	if err != nil {
+		event.Reason = err.Error()
+		if logger != nil {
+			logger.Error(event)
+		}
+	} else {
+		event.Status = resp.StatusCode
+		status = fmt.Sprintf("status:%dxx", resp.StatusCode/100)
+		if logger != nil {
+			logger.Info(event)
+		}
+	}
+	tags := []string{"host:" + r.URL.Host, methodTag(r.Method), status}
+	stat := t.stat(ctx)
+	stat.Count(t.RequestCounterName, 1, tags...)
+	stat.Timing(t.LatencyTimerName, duration, tags...)
+	return resp, err
+}
+
+// logger returns the logger in the context or the Logger if the context has
+// none. LoggerFromContext panics when the context has no logger.
+func (t *ClientTransport) logger(ctx context.Context) (logger Logger) {
+	defer func() {
+		if recover() != nil {
+			logger = t.Logger
+		}
+	}()
+	return LoggerFromContext(ctx)
+}
+
+// stat returns the stat client in the context or the Stat if the context has
+// none.
+func (t *ClientTransport) stat(ctx context.Context) Stat {
+	stat := StatFromContext(ctx)
+	if stat == nopStat && t.Stat != nil {
+		return t.Stat
+	}
+	return stat
+}
+
+func (t *ClientTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
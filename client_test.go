@@ -0,0 +1,203 @@
+package runhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClientContext(logger Logger, stat Stat) context.Context {
+	ctx := logevent.NewContext(context.Background(), logger)
+	ctx = xstats.NewContext(ctx, stat)
+	ctx = context.WithValue(ctx, requestIDKey{}, "abc-123")
+	return context.WithValue(ctx, traceKey{}, &Span{
+		TraceID: TraceID{1},
+		SpanID:  SpanID{2},
+		Sampled: true,
+	})
+}
+
+func TestClientTransport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	var seen http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	cmp := &ClientComponent{}
+	client, err := cmp.WithRequestIDHeader("X-Request-Id").New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+
+	tags := []interface{}{"host:" + host, "method:GET", "status:4xx"}
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		out, ok := event.(logOutboundRequest)
+		require.True(t, ok)
+		require.Equal(t, host, out.Host)
+		require.Equal(t, "/users/42", out.Path)
+		require.Equal(t, http.StatusTeapot, out.Status)
+	})
+	stat.EXPECT().Count(statCounterClientRequest, float64(1), tags...)
+	stat.EXPECT().Timing(statTimerClientRequest, gomock.Any(), tags...)
+	ctx := newTestClientContext(logger, stat)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/users/42", http.NoBody)
+	require.Nil(t, err)
+	resp, err := client.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTeapot, resp.StatusCode)
+	require.Equal(t, "abc-123", seen.Get("X-Request-Id"))
+	require.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", seen.Get("traceparent"))
+	require.Empty(t, req.Header, "the outbound request must not be modified")
+
+	// Headers set by the caller are kept.
+	logger.EXPECT().Info(gomock.Any())
+	stat.EXPECT().Count(statCounterClientRequest, float64(1), tags...)
+	stat.EXPECT().Timing(statTimerClientRequest, gomock.Any(), tags...)
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/users/42", http.NoBody)
+	require.Nil(t, err)
+	req.Header.Set("X-Request-Id", "caller")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err = client.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, "caller", seen.Get("X-Request-Id"))
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", seen.Get("traceparent"))
+}
+
+func TestClientTransportError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	tags := []interface{}{"host:" + host, "method:POST", "status:error"}
+	logger.EXPECT().Error(gomock.Any()).Do(func(event interface{}) {
+		out, ok := event.(logOutboundRequest)
+		require.True(t, ok)
+		require.NotEmpty(t, out.Reason)
+	})
+	stat.EXPECT().Count(statCounterClientRequest, float64(1), tags...)
+	stat.EXPECT().Timing(statTimerClientRequest, gomock.Any(), tags...)
+	client := &http.Client{Transport: &ClientTransport{
+		RequestCounterName: statCounterClientRequest,
+		LatencyTimerName:   statTimerClientRequest,
+	}}
+	req, err := http.NewRequestWithContext(newTestClientContext(logger, stat), http.MethodPost, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	_, err = client.Do(req)
+	require.NotNil(t, err)
+}
+
+func TestClientTransportNonStandardMethod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	tags := []interface{}{"host:" + host, "method:other", "status:2xx"}
+	logger.EXPECT().Info(gomock.Any())
+	stat.EXPECT().Count(statCounterClientRequest, float64(1), tags...)
+	stat.EXPECT().Timing(statTimerClientRequest, gomock.Any(), tags...)
+	client := &http.Client{Transport: &ClientTransport{
+		RequestCounterName: statCounterClientRequest,
+		LatencyTimerName:   statTimerClientRequest,
+	}}
+	req, err := http.NewRequestWithContext(newTestClientContext(logger, stat), "PURGE", ts.URL, http.NoBody)
+	require.Nil(t, err)
+	resp, err := client.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+}
+
+func TestClientTransportWithoutContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	tags := []interface{}{"host:" + host, "method:GET", "status:2xx"}
+	logger.EXPECT().Info(gomock.Any())
+	stat.EXPECT().Count(statCounterClientRequest, float64(1), tags...)
+	stat.EXPECT().Timing(statTimerClientRequest, gomock.Any(), tags...)
+	client := &http.Client{Transport: &ClientTransport{
+		Logger:             logger,
+		Stat:               stat,
+		RequestCounterName: statCounterClientRequest,
+		LatencyTimerName:   statTimerClientRequest,
+	}}
+	resp, err := client.Get(ts.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	// Requests are still sent without a logger or stat client.
+	client = &http.Client{Transport: &ClientTransport{}}
+	resp, err = client.Get(ts.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+}
+
+func TestClientComponentProxy(t *testing.T) {
+	cmp := &ClientComponent{}
+	conf := cmp.Settings()
+	conf.Proxy = "http://proxy.internal:3128"
+	client, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	base := client.Transport.(*RetryTransport).Base.(*ClientTransport).Base.(*http.Transport)
+	proxy, err := base.Proxy(httptest.NewRequest(http.MethodGet, "http://example.com", nil))
+	require.Nil(t, err)
+	require.Equal(t, &url.URL{Scheme: "http", Host: "proxy.internal:3128"}, proxy)
+
+	conf.Proxy = "://invalid"
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestRuntimeClient(t *testing.T) {
+	rt := newTestRuntime(t,
+		"RUNTIME_REQUESTID_HEADER=x-correlation-id",
+		"RUNTIME_CLIENT_TIMEOUT=3s",
+		"RUNTIME_CLIENT_MAXCONNSPERHOST=4",
+	)
+	require.NotNil(t, rt.Client)
+	require.Equal(t, "3s", rt.Client.Timeout.String())
+	transport := rt.Client.Transport.(*RetryTransport).Base.(*ClientTransport)
+	require.Equal(t, "X-Correlation-Id", transport.RequestIDHeader)
+	require.Equal(t, 4, transport.Base.(*http.Transport).MaxConnsPerHost)
+	require.Equal(t, rt.Logger, transport.Logger)
+}
+
+func TestRuntimeClientBackground(t *testing.T) {
+	rt := newTestRuntime(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	resp, err := rt.Client.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
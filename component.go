@@ -2,6 +2,8 @@ package runhttp
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/rs/xstats"
@@ -17,11 +19,22 @@ import (
 // a runtime.
 type Config struct {
 	HTTP      *HTTPConfig
+	Admin     *AdminConfig
 	ConnState *connstate.Config
 	Expvar    *expvar.Config
 	Logger    *log.Config
 	Stats     *stat.Config
 	Signal    *signals.Config
+	Restart   *RestartConfig
+	Shutdown  *ShutdownConfig
+	Upgrade   *UpgradeConfig
+	Health    *HealthConfig
+	RequestID *RequestIDConfig
+	Tracing   *TracingConfig
+	Recovery  *RecoveryConfig
+	AccessLog *AccessLogConfig
+	Metrics   *MetricsConfig
+	Client    *ClientConfig
 }
 
 // Name returns the configuration root as it would appear in a config file.
@@ -29,50 +42,127 @@ func (*Config) Name() string {
 	return "runtime"
 }
 
+// loadedConfig is the configuration rendered by the admin server, which
+// includes the configuration of each named server.
+type loadedConfig struct {
+	*Config
+	Servers map[string]*HTTPConfig `json:",omitempty"`
+}
+
 // Component implements the settings.Component interface for an HTTP runtime.
 type Component struct {
 	HTTP      *HTTPComponent
+	Admin     *AdminComponent
 	Connstate *connstate.Component
 	Expvar    *expvar.Component
 	Logger    *log.Component
 	Stats     *stat.Component
 	Signal    *signals.Component
+	Restart   *RestartComponent
+	Shutdown  *ShutdownComponent
+	Upgrade   *UpgradeComponent
+	Health    *HealthComponent
+	RequestID *RequestIDComponent
+	Tracing   *TracingComponent
+	Recovery  *RecoveryComponent
+	AccessLog *AccessLogComponent
+	Metrics   *MetricsComponent
+	Client    *ClientComponent
 	Handler   http.Handler
+	Servers   map[string]http.Handler
 }
 
 // NewComponent populates the component with some default values.
 func NewComponent() *Component {
 	return &Component{
-		HTTP:      &HTTPComponent{},
+		HTTP:      NewHTTPComponent(),
+		Admin:     NewAdminComponent(),
 		Connstate: connstate.NewComponent(),
 		Expvar:    expvar.NewComponent(),
 		Logger:    log.NewComponent(),
 		Stats:     stat.NewComponent(),
 		Signal:    signals.NewComponent(),
+		Restart:   &RestartComponent{},
+		Shutdown:  &ShutdownComponent{},
+		Upgrade:   &UpgradeComponent{},
+		Health:    &HealthComponent{},
+		RequestID: &RequestIDComponent{},
+		Tracing:   &TracingComponent{},
+		Recovery:  &RecoveryComponent{},
+		AccessLog: &AccessLogComponent{},
+		Metrics:   &MetricsComponent{},
+		Client:    &ClientComponent{},
 	}
 }
 
 // WithHandler returns a copy of the component bound to the given handler.
 func (c *Component) WithHandler(h http.Handler) *Component {
-	n := NewComponent()
+	n := *c
 	n.Handler = h
-	return n
+	return &n
+}
+
+// WithServers returns a copy of the component that runs an additional
+// server for each of the given handlers. Each server is configured by the
+// HTTPConfig of the same name given to NewWithServers. The named servers
+// are not part of Config because the settings library cannot describe a
+// map of groups, so a component with servers must be created through
+// NewWithServers rather than New.
+func (c *Component) WithServers(servers map[string]http.Handler) *Component {
+	n := *c
+	n.Servers = servers
+	return &n
 }
 
 // Settings generates a configuration object with all defaults set.
 func (c *Component) Settings() *Config {
 	return &Config{
 		HTTP:      c.HTTP.Settings(),
+		Admin:     c.Admin.Settings(),
 		ConnState: c.Connstate.Settings(),
 		Expvar:    c.Expvar.Settings(),
 		Logger:    c.Logger.Settings(),
 		Stats:     c.Stats.Settings(),
 		Signal:    c.Signal.Settings(),
+		Restart:   c.Restart.Settings(),
+		Shutdown:  c.Shutdown.Settings(),
+		Upgrade:   c.Upgrade.Settings(),
+		Health:    c.Health.Settings(),
+		RequestID: c.RequestID.Settings(),
+		Tracing:   c.Tracing.Settings(),
+		Recovery:  c.Recovery.Settings(),
+		AccessLog: c.AccessLog.Settings(),
+		Metrics:   c.Metrics.Settings(),
+		Client:    c.Client.Settings(),
 	}
 }
 
-// New produces a configured runtime.
+// ServerSettings generates a configuration for each named server with all
+// defaults set. The address of a named server has no default and must be
+// configured.
+func (c *Component) ServerSettings() map[string]*HTTPConfig {
+	confs := make(map[string]*HTTPConfig, len(c.Servers))
+	for name := range c.Servers {
+		conf := c.HTTP.Settings()
+		conf.Address = ""
+		confs[name] = conf
+	}
+	return confs
+}
+
+// New produces a configured runtime. It fails if the component has named
+// servers because their configuration is not part of Config.
 func (c *Component) New(ctx context.Context, conf *Config) (*Runtime, error) {
+	if len(c.Servers) > 0 {
+		return nil, errors.New("a runtime with named servers must be created with NewWithServers")
+	}
+	return c.NewWithServers(ctx, conf, nil)
+}
+
+// NewWithServers produces a configured runtime with a server for each of
+// the named handlers of the component, configured by the entry of the same
+// name in servers.
+func (c *Component) NewWithServers(ctx context.Context, conf *Config, servers map[string]*HTTPConfig) (*Runtime, error) {
 	logger, err := c.Logger.New(ctx, conf.Logger)
 	if err != nil {
 		return nil, err
@@ -93,19 +183,145 @@ func (c *Component) New(ctx context.Context, conf *Config) (*Runtime, error) {
 	if err != nil {
 		return nil, err
 	}
-	server, err := c.HTTP.New(ctx, conf.HTTP)
+	restart, err := c.Restart.New(ctx, conf.Restart)
+	if err != nil {
+		return nil, err
+	}
+	shutdown, err := c.Shutdown.New(ctx, conf.Shutdown)
+	if err != nil {
+		return nil, err
+	}
+	upgrade, err := c.Upgrade.New(ctx, conf.Upgrade)
+	if err != nil {
+		return nil, err
+	}
+	health, err := c.Health.WithStat(xstats.Copy(stats)).New(ctx, conf.Health)
+	if err != nil {
+		return nil, err
+	}
+	requestID, err := c.RequestID.New(ctx, conf.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	tracer, err := c.Tracing.WithStat(xstats.Copy(stats)).New(ctx, conf.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	recovery, err := c.Recovery.WithStat(xstats.Copy(stats)).New(ctx, conf.Recovery)
+	if err != nil {
+		return nil, err
+	}
+	accessLog, err := c.AccessLog.New(ctx, conf.AccessLog)
 	if err != nil {
 		return nil, err
 	}
-	server.ConnState = cs.HandleEvent
+	metrics, err := c.Metrics.WithStat(xstats.Copy(stats)).New(ctx, conf.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	client, err := c.Client.
+		WithRequestIDHeader(requestID.Header).
+		WithLogger(logger).
+		WithStat(xstats.Copy(stats)).
+		WithHealth(health).
+		New(ctx, conf.Client)
+	if err != nil {
+		return nil, err
+	}
+	hosted, err := c.HTTP.NewHosted(ctx, conf.HTTP, logger, xstats.Copy(stats))
+	if err != nil {
+		return nil, err
+	}
+	admin, err := c.Admin.
+		WithLogger(logger).
+		WithStat(xstats.Copy(stats)).
+		WithHandler(NewAdminRouter(&loadedConfig{Config: conf, Servers: servers})).
+		New(ctx, conf.Admin)
+	if err != nil {
+		return nil, err
+	}
+	named := make(map[string]*HostedServer, len(c.Servers))
+	for name, h := range c.Servers {
+		var server *HostedServer
+		server, err = c.newNamedServer(ctx, name, h, servers[name], conf.ConnState, logger, stats)
+		if err != nil {
+			return nil, err
+		}
+		named[name] = server
+	}
 
 	return &Runtime{
-		Logger:    logger,
-		Stats:     stats,
-		ConnState: cs,
-		Expvar:    expvar,
-		Exit:      exit,
-		Server:    server,
-		Handler:   c.Handler,
+		Logger:       logger,
+		Stats:        stats,
+		ConnState:    cs,
+		Expvar:       expvar,
+		Exit:         exit,
+		Restart:      restart,
+		Shutdown:     shutdown,
+		Upgrade:      upgrade,
+		Health:       health,
+		RequestID:    requestID,
+		Tracer:       tracer,
+		Recovery:     recovery,
+		AccessLog:    accessLog,
+		Metrics:      metrics,
+		Client:       client,
+		Server:       withConnState(hosted.Server, cs),
+		Listen:       hosted.Listen,
+		Certificates: hosted.Certificates,
+		Handler:      c.Handler,
+		Admin:        admin,
+		Servers:      named,
 	}, nil
 }
+
+// newNamedServer creates one of the named servers. Each has its own
+// connection state tracking so that the metrics are tagged with the name
+// of the server.
+func (c *Component) newNamedServer(ctx context.Context, name string, h http.Handler, conf *HTTPConfig, csConf *connstate.Config, logger Logger, stats Stat) (*HostedServer, error) {
+	if err := validServerName(name); err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("server %s has no configuration", name)
+	}
+	stat := xstats.Copy(stats)
+	stat.AddTags("server:" + name)
+	cs, err := c.Connstate.WithStat(stat).New(ctx, csConf)
+	if err != nil {
+		return nil, err
+	}
+	hosted, err := c.HTTP.NewHosted(ctx, conf, logger, stat)
+	if err != nil {
+		return nil, fmt.Errorf("server %s: %w", name, err)
+	}
+	hosted.Server = withConnState(hosted.Server, cs)
+	hosted.Handler = h
+	hosted.ConnState = cs
+	return hosted, nil
+}
+
+// validServerName reports whether the name of a server can be used as a
+// configuration group. Only letters and digits are allowed so that every
+// name maps to a valid environment variable.
+func validServerName(name string) error {
+	if name == "" {
+		return errors.New("server name must not be empty")
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return fmt.Errorf("server name %q must contain only letters and digits", name)
+		}
+	}
+	return nil
+}
+
+// withConnState wraps a ServerFn so that each server reports its
+// connection states to cs.
+func withConnState(serverFn ServerFn, cs *connstate.ConnState) ServerFn {
+	return func() *http.Server {
+		server := serverFn()
+		server.ConnState = cs.HandleEvent
+		return server
+	}
+}
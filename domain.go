@@ -2,6 +2,7 @@ package runhttp
 
 import (
 	"context"
+	"net"
 	"net/http"
 
 	"github.com/rs/xstats"
@@ -41,3 +42,12 @@ type SignalFn func() chan error
 // ServerFn is a constructor for *http.Server instances that will
 // be hosted by the runtime.
 type ServerFn func() *http.Server
+
+// ListenerFn is a constructor for the net.Listener on which the runtime
+// accepts connections.
+type ListenerFn func() (net.Listener, error)
+
+// RestartSignal emits a value each time the runtime should replace its
+// server with a new one from the ServerFn. Unlike a shutdown signal it
+// may emit any number of times.
+type RestartSignal chan struct{}
@@ -0,0 +1,549 @@
+package runhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TracingOutputNull is the selection for no span exports.
+	TracingOutputNull = "NULL"
+	// TracingOutputStdout selects JSON lines written to stdout.
+	TracingOutputStdout = "STDOUT"
+	// TracingOutputZipkin selects the Zipkin v2 JSON HTTP API.
+	TracingOutputZipkin = "ZIPKIN"
+	// TracingOutputOTLP selects the OTLP/HTTP JSON protocol.
+	TracingOutputOTLP = "OTLP"
+
+	statCounterSpanDropped = "http.server.tracing.dropped"
+	statCounterSpanFailed  = "http.server.tracing.failed"
+
+	defaultTracingSampleRate    = 1.0
+	defaultTracingQueueSize     = 2048
+	defaultTracingBatchSize     = 512
+	defaultTracingFlushInterval = 5 * time.Second
+	defaultTracingExportTimeout = 10 * time.Second
+	defaultZipkinEndpoint       = "http://localhost:9411/api/v2/spans"
+	defaultOTLPEndpoint         = "http://localhost:4318/v1/traces"
+
+	otlpScopeName      = "github.com/asecurityteam/runhttp"
+	otlpSpanKindServer = 2
+	otlpStatusError    = 2
+)
+
+type logSpanFlushFailed struct {
+	Reason  string `logevent:"reason"`
+	Message string `logevent:"message,default=span-flush-failed"`
+}
+
+// TracingConfig is the container for tracing settings.
+type TracingConfig struct {
+	Output              string        `description:"Destination of sampled spans. One of NULL, STDOUT, ZIPKIN, OTLP."`
+	ServiceName         string        `description:"Name of the service recorded with each span. Empty uses the name of the executable."`
+	SampleRate          float64       `description:"Probability, from 0 to 1, that a new trace is sampled. Continued traces keep the decision of the caller unless IgnoreParentSampled is set."`
+	IgnoreParentSampled bool          `description:"Whether continued traces are sampled with the SampleRate rather than by the decision of the caller. Set at the edge so that callers cannot force sampling."`
+	QueueSize           int           `description:"Maximum number of spans waiting to be exported. Spans are dropped while the queue is full."`
+	BatchSize           int           `description:"Maximum number of spans sent in a single export."`
+	FlushInterval       time.Duration `description:"Interval on which queued spans are exported."`
+	ExportTimeout       time.Duration `description:"Maximum duration of a single export."`
+	DroppedCounter      string        `description:"Name of the counter metric tracking spans dropped because the queue was full."`
+	FailedCounter       string        `description:"Name of the counter metric tracking spans that failed to export."`
+	TraceResponse       bool          `description:"Whether the trace and span IDs of the server span are returned to the caller in the traceresponse header."`
+	Zipkin              *ZipkinConfig
+	OTLP                *OTLPConfig
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*TracingConfig) Name() string {
+	return "tracing"
+}
+
+// Description returns the help information for the configuration root.
+func (*TracingConfig) Description() string {
+	return "Tracing configuration."
+}
+
+// ZipkinConfig contains the settings of the ZIPKIN output.
+type ZipkinConfig struct {
+	Endpoint string `description:"URL of the Zipkin v2 spans API."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*ZipkinConfig) Name() string {
+	return "zipkin"
+}
+
+// Description returns the help information for the configuration root.
+func (*ZipkinConfig) Description() string {
+	return "Zipkin output configuration."
+}
+
+// OTLPConfig contains the settings of the OTLP output.
+type OTLPConfig struct {
+	Endpoint string            `description:"URL of the OTLP/HTTP traces endpoint."`
+	Headers  map[string]string `description:"Additional headers sent with each export, such as credentials. Given as a JSON object in the environment."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*OTLPConfig) Name() string {
+	return "otlp"
+}
+
+// Description returns the help information for the configuration root.
+func (*OTLPConfig) Description() string {
+	return "OTLP output configuration."
+}
+
+// TracingComponent implements the settings.Component interface for
+// request tracing.
+type TracingComponent struct {
+	Stat Stat
+}
+
+// WithStat returns a copy of the component that counts dropped and failed
+// spans with the given stat client.
+func (c *TracingComponent) WithStat(stat Stat) *TracingComponent {
+	n := *c
+	n.Stat = stat
+	return &n
+}
+
+// Settings returns a configuration with all defaults set.
+func (*TracingComponent) Settings() *TracingConfig {
+	return &TracingConfig{
+		Output:         TracingOutputNull,
+		SampleRate:     defaultTracingSampleRate,
+		QueueSize:      defaultTracingQueueSize,
+		BatchSize:      defaultTracingBatchSize,
+		FlushInterval:  defaultTracingFlushInterval,
+		ExportTimeout:  defaultTracingExportTimeout,
+		DroppedCounter: statCounterSpanDropped,
+		FailedCounter:  statCounterSpanFailed,
+		Zipkin:         &ZipkinConfig{Endpoint: defaultZipkinEndpoint},
+		OTLP:           &OTLPConfig{Endpoint: defaultOTLPEndpoint},
+	}
+}
+
+// New produces a Tracer bound to the given configuration. Spans are only
+// exported when an output other than NULL is selected.
+func (c *TracingComponent) New(_ context.Context, conf *TracingConfig) (*Tracer, error) {
+	if conf.SampleRate < 0 || conf.SampleRate > 1 {
+		return nil, fmt.Errorf("tracing samplerate must be between 0 and 1 but was %g", conf.SampleRate)
+	}
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = filepath.Base(os.Args[0])
+	}
+	var exporter SpanExporter
+	switch {
+	case strings.EqualFold(conf.Output, TracingOutputNull):
+		return &Tracer{
+			SampleRate:          conf.SampleRate,
+			IgnoreParentSampled: conf.IgnoreParentSampled,
+			TraceResponse:       conf.TraceResponse,
+		}, nil
+	case strings.EqualFold(conf.Output, TracingOutputStdout):
+		exporter = &WriterExporter{Writer: os.Stdout, ServiceName: serviceName}
+	case strings.EqualFold(conf.Output, TracingOutputZipkin):
+		if conf.Zipkin.Endpoint == "" {
+			return nil, errors.New("tracing zipkin endpoint must not be empty")
+		}
+		exporter = &ZipkinExporter{Endpoint: conf.Zipkin.Endpoint, ServiceName: serviceName}
+	case strings.EqualFold(conf.Output, TracingOutputOTLP):
+		if conf.OTLP.Endpoint == "" {
+			return nil, errors.New("tracing otlp endpoint must not be empty")
+		}
+		exporter = &OTLPExporter{Endpoint: conf.OTLP.Endpoint, Headers: conf.OTLP.Headers, ServiceName: serviceName}
+	default:
+		return nil, fmt.Errorf("unknown tracing output %s", conf.Output)
+	}
+	if conf.QueueSize < 1 {
+		return nil, fmt.Errorf("tracing queuesize must be positive but was %d", conf.QueueSize)
+	}
+	if conf.BatchSize < 1 {
+		return nil, fmt.Errorf("tracing batchsize must be positive but was %d", conf.BatchSize)
+	}
+	if conf.FlushInterval <= 0 {
+		return nil, fmt.Errorf("tracing flushinterval must be positive but was %s", conf.FlushInterval)
+	}
+	batch := NewBatchExporter(exporter, conf.QueueSize)
+	batch.Stat = c.Stat
+	batch.DroppedCounterName = conf.DroppedCounter
+	batch.FailedCounterName = conf.FailedCounter
+	batch.BatchSize = conf.BatchSize
+	batch.FlushInterval = conf.FlushInterval
+	batch.Timeout = conf.ExportTimeout
+	return &Tracer{
+		Exporter:            batch,
+		SampleRate:          conf.SampleRate,
+		IgnoreParentSampled: conf.IgnoreParentSampled,
+		TraceResponse:       conf.TraceResponse,
+	}, nil
+}
+
+// BatchExporter queues spans and sends them to the Exporter in batches of
+// up to BatchSize. A batch is sent once it is full and otherwise on each
+// FlushInterval. Spans that arrive while the queue is full are dropped
+// rather than delaying requests. If a Stat is set then dropped spans and
+// spans that fail to export are counted.
+//
+// Batches are only sent in the background while Run is running. A Runtime
+// starts running the exporter of its Tracer on its first run and flushes
+// the queue each time it shuts down.
+type BatchExporter struct {
+	Exporter           SpanExporter
+	Stat               Stat
+	DroppedCounterName string
+	FailedCounterName  string
+	BatchSize          int
+	FlushInterval      time.Duration
+	Timeout            time.Duration
+
+	queue   chan *Span
+	full    chan struct{}
+	stopCh  chan struct{}
+	stopped sync.Once
+	// flushLock ensures that only one caller drains the queue at a time so
+	// that batches are never split between concurrent flushes.
+	flushLock sync.Mutex
+}
+
+// NewBatchExporter creates an exporter that queues up to queueSize spans.
+func NewBatchExporter(exporter SpanExporter, queueSize int) *BatchExporter {
+	return &BatchExporter{
+		Exporter:           exporter,
+		DroppedCounterName: statCounterSpanDropped,
+		FailedCounterName:  statCounterSpanFailed,
+		BatchSize:          defaultTracingBatchSize,
+		FlushInterval:      defaultTracingFlushInterval,
+		Timeout:            defaultTracingExportTimeout,
+		queue:              make(chan *Span, queueSize),
+		full:               make(chan struct{}, 1),
+		stopCh:             make(chan struct{}),
+	}
+}
+
+// ExportSpans queues the spans for export. It never blocks.
+func (b *BatchExporter) ExportSpans(_ context.Context, spans []*Span) error {
+	var dropped int
+	for _, span := range spans {
+		select {
+		case <-b.stopCh:
+			dropped++
+			continue
+		default:
+		}
+		select {
+		case b.queue <- span:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 && b.Stat != nil {
+		b.Stat.Count(b.DroppedCounterName, float64(dropped))
+	}
+	if len(b.queue) >= b.BatchSize {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run sends queued spans until Close is called.
+func (b *BatchExporter) Run() {
+	ticker := time.NewTicker(b.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.full:
+		case <-b.stopCh:
+			return
+		}
+		_ = b.Flush(context.Background())
+	}
+}
+
+// Flush sends every queued span. It returns the errors of any failed
+// exports or the error of ctx if it ends before the queue is empty.
+func (b *BatchExporter) Flush(ctx context.Context) error {
+	b.flushLock.Lock()
+	defer b.flushLock.Unlock()
+	var err error
+	batch := make([]*Span, 0, b.BatchSize)
+	for {
+		batch = batch[:0]
+	fill:
+		for len(batch) < b.BatchSize {
+			select {
+			case span := <-b.queue:
+				batch = append(batch, span)
+			default:
+				break fill
+			}
+		}
+		if len(batch) < 1 {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			b.fail(len(batch))
+			return errors.Join(err, ctxErr)
+		}
+		err = errors.Join(err, b.export(ctx, batch))
+	}
+}
+
+// export sends a single batch within the timeout.
+func (b *BatchExporter) export(ctx context.Context, batch []*Span) error {
+	if b.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Timeout)
+		defer cancel()
+	}
+	err := b.Exporter.ExportSpans(ctx, batch)
+	if err != nil {
+		b.fail(len(batch))
+	}
+	return err
+}
+
+func (b *BatchExporter) fail(spans int) {
+	if b.Stat != nil {
+		b.Stat.Count(b.FailedCounterName, float64(spans))
+	}
+}
+
+// Close stops the background exports and sends any queued spans. Spans
+// given to the exporter after Close are dropped.
+func (b *BatchExporter) Close() error {
+	b.stopped.Do(func() {
+		close(b.stopCh)
+	})
+	return b.Flush(context.Background())
+}
+
+// WriterExporter writes each span as a line of JSON in the Zipkin v2
+// format.
+type WriterExporter struct {
+	Writer      io.Writer
+	ServiceName string
+
+	lock sync.Mutex
+}
+
+// ExportSpans writes the spans.
+func (e *WriterExporter) ExportSpans(_ context.Context, spans []*Span) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, span := range spans {
+		if err := encoder.Encode(newZipkinSpan(span, e.ServiceName)); err != nil {
+			return err
+		}
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	_, err := e.Writer.Write(buf.Bytes())
+	return err
+}
+
+// ZipkinExporter sends spans to the Zipkin v2 JSON HTTP API. The default
+// client is used when Client is nil.
+type ZipkinExporter struct {
+	Client      *http.Client
+	Endpoint    string
+	ServiceName string
+}
+
+// ExportSpans sends the spans in a single request.
+func (e *ZipkinExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	body := make([]zipkinSpan, 0, len(spans))
+	for _, span := range spans {
+		body = append(body, newZipkinSpan(span, e.ServiceName))
+	}
+	return postJSON(ctx, e.Client, e.Endpoint, nil, body)
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+func newZipkinSpan(span *Span, serviceName string) zipkinSpan {
+	out := zipkinSpan{
+		TraceID:       span.TraceID.String(),
+		ID:            span.SpanID.String(),
+		Name:          span.Name,
+		Kind:          span.Kind,
+		Timestamp:     span.Start.UnixMicro(),
+		Duration:      span.End.Sub(span.Start).Microseconds(),
+		LocalEndpoint: zipkinEndpoint{ServiceName: serviceName},
+		Tags:          make(map[string]string, len(span.Attributes)+1),
+	}
+	if span.ParentID.IsValid() {
+		out.ParentID = span.ParentID.String()
+	}
+	for key, value := range span.Attributes {
+		out.Tags[key] = value
+	}
+	if span.Error {
+		// Zipkin marks any span with an error tag as failed.
+		out.Tags["error"] = span.Attributes["http.response.status_code"]
+	}
+	return out
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using the JSON
+// encoding of OTLP/HTTP. The default client is used when Client is nil.
+type OTLPExporter struct {
+	Client      *http.Client
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+}
+
+// ExportSpans sends the spans in a single request.
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		out = append(out, newOTLPSpan(span))
+	}
+	body := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{newOTLPAttribute("service.name", e.ServiceName)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: otlpScopeName},
+			Spans: out,
+		}},
+	}}}
+	return postJSON(ctx, e.Client, e.Endpoint, e.Headers, body)
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+// otlpSpan is the JSON encoding of an OTLP span. IDs are hex rather than
+// base64 and 64 bit integers are strings, as the protocol requires.
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func newOTLPAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+func newOTLPSpan(span *Span) otlpSpan {
+	out := otlpSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		TraceState:        span.TraceState,
+		Name:              span.Name,
+		Kind:              otlpSpanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		Attributes:        make([]otlpAttribute, 0, len(span.Attributes)),
+	}
+	if span.ParentID.IsValid() {
+		out.ParentSpanID = span.ParentID.String()
+	}
+	for key, value := range span.Attributes {
+		out.Attributes = append(out.Attributes, newOTLPAttribute(key, value))
+	}
+	if span.Error {
+		out.Status.Code = otlpStatusError
+	}
+	return out
+}
+
+// postJSON sends the body to the endpoint and fails on any status other
+// than 2xx.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package runhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type failingExporter struct{}
+
+func (failingExporter) ExportSpans(context.Context, []*Span) error {
+	return errors.New("unavailable")
+}
+
+func newTestSpan(parent bool) *Span {
+	start := time.Unix(1700000000, 0)
+	span := &Span{
+		TraceID:    TraceID{0x4b, 0xf9},
+		SpanID:     SpanID{0x00, 0xf0},
+		TraceState: "congo=t61rcWkgMzE",
+		Sampled:    true,
+		Name:       "GET /users/{id}",
+		Kind:       SpanKindServer,
+		Start:      start,
+		End:        start.Add(1500 * time.Microsecond),
+		Attributes: map[string]string{
+			"http.route":                "/users/{id}",
+			"http.response.status_code": "503",
+		},
+		Error: true,
+	}
+	if parent {
+		span.ParentID = SpanID{0xaa}
+	}
+	return span
+}
+
+// recordingServer collects the bodies and headers of the requests sent to
+// it.
+type recordingServer struct {
+	lock    sync.Mutex
+	bodies  [][]byte
+	headers []http.Header
+}
+
+func (s *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	_, _ = body.ReadFrom(r.Body)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bodies = append(s.bodies, body.Bytes())
+	s.headers = append(s.headers, r.Header.Clone())
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *recordingServer) requests() ([][]byte, []http.Header) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([][]byte(nil), s.bodies...), append([]http.Header(nil), s.headers...)
+}
+
+func TestTracingComponent(t *testing.T) {
+	cmp := &TracingComponent{}
+	tracer, err := cmp.New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	require.Nil(t, tracer.Exporter)
+	require.Equal(t, 1.0, tracer.SampleRate)
+
+	conf := cmp.Settings()
+	conf.Output = "zipkin"
+	conf.QueueSize = 4
+	conf.BatchSize = 2
+	tracer, err = cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	batch, ok := tracer.Exporter.(*BatchExporter)
+	require.True(t, ok)
+	require.Equal(t, 2, batch.BatchSize)
+	require.Equal(t, 4, cap(batch.queue))
+	zipkin, ok := batch.Exporter.(*ZipkinExporter)
+	require.True(t, ok)
+	require.Equal(t, defaultZipkinEndpoint, zipkin.Endpoint)
+	require.NotEmpty(t, zipkin.ServiceName)
+}
+
+func TestTracingComponentInvalid(t *testing.T) {
+	cmp := &TracingComponent{}
+	tc := []struct {
+		name   string
+		modify func(*TracingConfig)
+	}{
+		{name: "unknown output", modify: func(c *TracingConfig) { c.Output = "JAEGER" }},
+		{name: "negative sample rate", modify: func(c *TracingConfig) { c.SampleRate = -0.1 }},
+		{name: "sample rate above one", modify: func(c *TracingConfig) { c.SampleRate = 1.5 }},
+		{name: "empty zipkin endpoint", modify: func(c *TracingConfig) { c.Output = TracingOutputZipkin; c.Zipkin.Endpoint = "" }},
+		{name: "empty otlp endpoint", modify: func(c *TracingConfig) { c.Output = TracingOutputOTLP; c.OTLP.Endpoint = "" }},
+		{name: "zero queue size", modify: func(c *TracingConfig) { c.Output = TracingOutputStdout; c.QueueSize = 0 }},
+		{name: "zero batch size", modify: func(c *TracingConfig) { c.Output = TracingOutputStdout; c.BatchSize = 0 }},
+		{name: "zero flush interval", modify: func(c *TracingConfig) { c.Output = TracingOutputStdout; c.FlushInterval = 0 }},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := cmp.Settings()
+			tt.modify(conf)
+			_, err := cmp.New(context.Background(), conf)
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestTracerSampleRate(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := &Tracer{Exporter: exporter, SampleRate: 0}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	require.False(t, tracer.startSpan(r).Sampled)
+
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, tracer.startSpan(r).Sampled)
+
+	tracer.SampleRate = 0.5
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	var sampled int
+	for i := 0; i < 1000; i++ {
+		if tracer.startSpan(r).Sampled {
+			sampled++
+		}
+	}
+	require.InDelta(t, 500, sampled, 100)
+}
+
+func TestBatchExporter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	exporter := &recordingExporter{}
+	batch := NewBatchExporter(exporter, 3)
+	batch.Stat = stat
+	batch.BatchSize = 2
+
+	stat.EXPECT().Count(statCounterSpanDropped, float64(1))
+	spans := []*Span{newTestSpan(false), newTestSpan(false), newTestSpan(false), newTestSpan(false)}
+	require.Nil(t, batch.ExportSpans(context.Background(), spans))
+	require.Empty(t, exporter.recorded())
+
+	require.Nil(t, batch.Flush(context.Background()))
+	require.Equal(t, spans[:3], exporter.recorded())
+
+	require.Nil(t, batch.Close())
+	stat.EXPECT().Count(statCounterSpanDropped, float64(1))
+	require.Nil(t, batch.ExportSpans(context.Background(), spans[:1]))
+	require.Nil(t, batch.Flush(context.Background()))
+	require.Len(t, exporter.recorded(), 3)
+}
+
+func TestBatchExporterFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	batch := NewBatchExporter(failingExporter{}, 8)
+	batch.Stat = stat
+	batch.BatchSize = 2
+
+	stat.EXPECT().Count(statCounterSpanFailed, float64(2))
+	stat.EXPECT().Count(statCounterSpanFailed, float64(1))
+	spans := []*Span{newTestSpan(false), newTestSpan(false), newTestSpan(false)}
+	require.Nil(t, batch.ExportSpans(context.Background(), spans))
+	require.NotNil(t, batch.Flush(context.Background()))
+}
+
+func TestBatchExporterRun(t *testing.T) {
+	exporter := &recordingExporter{}
+	batch := NewBatchExporter(exporter, 8)
+	batch.BatchSize = 2
+	batch.FlushInterval = time.Hour
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		batch.Run()
+	}()
+
+	// A full batch is sent without waiting for the interval.
+	require.Nil(t, batch.ExportSpans(context.Background(), []*Span{newTestSpan(false), newTestSpan(false)}))
+	require.Eventually(t, func() bool {
+		return len(exporter.recorded()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Nil(t, batch.ExportSpans(context.Background(), []*Span{newTestSpan(false)}))
+	require.Nil(t, batch.Close())
+	<-done
+	require.Len(t, exporter.recorded(), 3)
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := &WriterExporter{Writer: &buf, ServiceName: "svc"}
+	require.Nil(t, exporter.ExportSpans(context.Background(), []*Span{newTestSpan(true), newTestSpan(false)}))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var span zipkinSpan
+	require.Nil(t, json.Unmarshal(lines[0], &span))
+	require.Equal(t, "aa00000000000000", span.ParentID)
+	require.Equal(t, "svc", span.LocalEndpoint.ServiceName)
+	var root zipkinSpan
+	require.Nil(t, json.Unmarshal(lines[1], &root))
+	require.Equal(t, "", root.ParentID)
+}
+
+func TestZipkinExporter(t *testing.T) {
+	server := &recordingServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	exporter := &ZipkinExporter{Endpoint: ts.URL, ServiceName: "svc"}
+	require.Nil(t, exporter.ExportSpans(context.Background(), []*Span{newTestSpan(true)}))
+
+	bodies, headers := server.requests()
+	require.Len(t, bodies, 1)
+	require.Equal(t, "application/json", headers[0].Get("Content-Type"))
+	var spans []map[string]interface{}
+	require.Nil(t, json.Unmarshal(bodies[0], &spans))
+	require.Equal(t, []map[string]interface{}{{
+		"traceId":       "4bf90000000000000000000000000000",
+		"id":            "00f0000000000000",
+		"parentId":      "aa00000000000000",
+		"name":          "GET /users/{id}",
+		"kind":          "SERVER",
+		"timestamp":     float64(1700000000000000),
+		"duration":      float64(1500),
+		"localEndpoint": map[string]interface{}{"serviceName": "svc"},
+		"tags": map[string]interface{}{
+			"http.route":                "/users/{id}",
+			"http.response.status_code": "503",
+			"error":                     "503",
+		},
+	}}, spans)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	server := &recordingServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	exporter := &OTLPExporter{
+		Endpoint:    ts.URL,
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		ServiceName: "svc",
+	}
+	require.Nil(t, exporter.ExportSpans(context.Background(), []*Span{newTestSpan(true)}))
+
+	bodies, headers := server.requests()
+	require.Len(t, bodies, 1)
+	require.Equal(t, "application/json", headers[0].Get("Content-Type"))
+	require.Equal(t, "Bearer token", headers[0].Get("Authorization"))
+	var req otlpRequest
+	require.Nil(t, json.Unmarshal(bodies[0], &req))
+	require.Len(t, req.ResourceSpans, 1)
+	require.Equal(t, []otlpAttribute{newOTLPAttribute("service.name", "svc")}, req.ResourceSpans[0].Resource.Attributes)
+	require.Len(t, req.ResourceSpans[0].ScopeSpans, 1)
+	require.Equal(t, otlpScopeName, req.ResourceSpans[0].ScopeSpans[0].Scope.Name)
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	require.Equal(t, "4bf90000000000000000000000000000", spans[0].TraceID)
+	require.Equal(t, "00f0000000000000", spans[0].SpanID)
+	require.Equal(t, "aa00000000000000", spans[0].ParentSpanID)
+	require.Equal(t, "congo=t61rcWkgMzE", spans[0].TraceState)
+	require.Equal(t, otlpSpanKindServer, spans[0].Kind)
+	require.Equal(t, "1700000000000000000", spans[0].StartTimeUnixNano)
+	require.Equal(t, "1700000000001500000", spans[0].EndTimeUnixNano)
+	require.ElementsMatch(t, []otlpAttribute{
+		newOTLPAttribute("http.route", "/users/{id}"),
+		newOTLPAttribute("http.response.status_code", "503"),
+	}, spans[0].Attributes)
+	require.Equal(t, otlpStatusError, spans[0].Status.Code)
+}
+
+func TestOTLPExporterStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	exporter := &OTLPExporter{Endpoint: ts.URL}
+	require.NotNil(t, exporter.ExportSpans(context.Background(), []*Span{newTestSpan(false)}))
+}
+
+func TestRuntimeTracingFlush(t *testing.T) {
+	server := &recordingServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	rt := newTestRuntime(t,
+		"RUNTIME_TRACING_OUTPUT=ZIPKIN",
+		"RUNTIME_TRACING_SERVICENAME=svc",
+		"RUNTIME_TRACING_FLUSHINTERVAL=1h",
+		"RUNTIME_TRACING_TRACERESPONSE=true",
+		"RUNTIME_TRACING_ZIPKIN_ENDPOINT="+ts.URL,
+	)
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+	<-rt.Ready()
+	resp, err := http.Get("http://" + rt.Addr().String() + "/users/42")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Regexp(t, "^00-[0-9a-f]{32}-[0-9a-f]{16}-01$", resp.Header.Get("traceresponse"))
+	bodies, _ := server.requests()
+	require.Empty(t, bodies)
+
+	rt.Exit <- nil
+	require.Nil(t, <-done)
+	bodies, _ = server.requests()
+	require.Len(t, bodies, 1)
+	var spans []zipkinSpan
+	require.Nil(t, json.Unmarshal(bodies[0], &spans))
+	require.Len(t, spans, 1)
+	require.Equal(t, resp.Header.Get("traceresponse")[3:35], spans[0].TraceID)
+	require.Equal(t, "svc", spans[0].LocalEndpoint.ServiceName)
+	require.Equal(t, "404", spans[0].Tags["http.response.status_code"])
+}
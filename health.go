@@ -0,0 +1,408 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthPass is the status of a check, or a report, without failures.
+	HealthPass = "pass"
+	// HealthWarn is the status of a report in which only non-critical
+	// checks failed.
+	HealthWarn = "warn"
+	// HealthFail is the status of a failed check or of a report in which
+	// a critical check failed.
+	HealthFail = "fail"
+
+	statCounterHealthPass = "http.server.health.pass"
+	statCounterHealthFail = "http.server.health.fail"
+	statTimerHealthCheck  = "http.server.health.latency"
+
+	defaultHealthCheckTimeout = 5 * time.Second
+	// defaultHealthStaleness is the number of intervals after which the
+	// cached result of a background check is considered stale.
+	defaultHealthStaleness = 3
+)
+
+// HealthConfig is the container for health check settings.
+type HealthConfig struct {
+	PassCounter  string `description:"Name of the counter metric tracking passed health checks."`
+	FailCounter  string `description:"Name of the counter metric tracking failed health checks."`
+	LatencyTimer string `description:"Name of the timing metric tracking the latency of health checks."`
+	TCP          *TCPCheckConfig
+	HTTP         *HTTPCheckConfig
+	DNS          *DNSCheckConfig
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*HealthConfig) Name() string {
+	return "health"
+}
+
+// Description returns the help information for the configuration root.
+func (*HealthConfig) Description() string {
+	return "Health check configuration."
+}
+
+// HealthComponent implements the settings.Component interface for the
+// health check registry.
+type HealthComponent struct {
+	Stat Stat
+}
+
+// WithStat returns a copy of the component that reports the results of
+// health checks to the given stat client.
+func (c *HealthComponent) WithStat(stat Stat) *HealthComponent {
+	n := *c
+	n.Stat = stat
+	return &n
+}
+
+// Settings returns a configuration with all defaults set.
+func (*HealthComponent) Settings() *HealthConfig {
+	return &HealthConfig{
+		PassCounter:  statCounterHealthPass,
+		FailCounter:  statCounterHealthFail,
+		LatencyTimer: statTimerHealthCheck,
+		TCP:          &TCPCheckConfig{CheckConfig: newCheckConfig()},
+		HTTP: &HTTPCheckConfig{
+			MinStatus:   defaultHTTPCheckMinStatus,
+			MaxStatus:   defaultHTTPCheckMaxStatus,
+			CheckConfig: newCheckConfig(),
+		},
+		DNS: &DNSCheckConfig{CheckConfig: newCheckConfig()},
+	}
+}
+
+// New produces a health check registry bound to the given configuration.
+// Any checks declared in the configuration are registered.
+func (c *HealthComponent) New(_ context.Context, conf *HealthConfig) (*HealthRegistry, error) {
+	health := NewHealthRegistry()
+	health.Stat = c.Stat
+	health.PassCounterName = conf.PassCounter
+	health.FailCounterName = conf.FailCounter
+	health.LatencyTimerName = conf.LatencyTimer
+	checks, err := configuredChecks(conf)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range checks {
+		if err = health.Register(check); err != nil {
+			return nil, err
+		}
+	}
+	return health, nil
+}
+
+// HealthCheckFn reports the health of a dependency or subsystem. A nil
+// error means the check passed.
+type HealthCheckFn func(context.Context) error
+
+// HealthCheck is a named check of the health of a service. A failed
+// Critical check marks the service unhealthy while other failures are only
+// reported. Liveness checks are included in both the liveness and the
+// readiness report and all other checks only in the readiness report.
+//
+// A check that does not finish within the Timeout, or five seconds if no
+// Timeout is set, fails.
+//
+// A check with an Interval runs in the background on that interval rather
+// than on each probe and probes report the last result. The result fails
+// once it is older than the Staleness, or three intervals if no Staleness
+// is set, so that a check that stops completing is not reported healthy.
+type HealthCheck struct {
+	Name      string
+	Check     HealthCheckFn
+	Timeout   time.Duration
+	Critical  bool
+	Liveness  bool
+	Interval  time.Duration
+	Staleness time.Duration
+}
+
+// HealthCheckResult is the outcome of a single check.
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Latency  string `json:"latency"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport is the outcome of every check included in a liveness or
+// readiness probe.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Reason string                       `json:"reason,omitempty"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+}
+
+// Healthy reports whether every critical check passed.
+func (r HealthReport) Healthy() bool {
+	return r.Status != HealthFail
+}
+
+// HealthRegistry is the set of checks that determine the liveness and
+// readiness of a service. Checks may be registered at any time and are
+// safe for concurrent use.
+//
+// Background checks only run while Watch is running. A Runtime starts
+// watching on its first run. If a Stat is set then every run of a check is
+// counted as passed or failed and timed, tagged with the name of the check.
+type HealthRegistry struct {
+	Stat             Stat
+	PassCounterName  string
+	FailCounterName  string
+	LatencyTimerName string
+
+	lock     sync.RWMutex
+	checks   map[string]*healthEntry
+	watching bool
+	stopCh   chan struct{}
+	stopped  sync.Once
+}
+
+// healthEntry is a registered check and, for a background check, its last
+// result.
+type healthEntry struct {
+	check     HealthCheck
+	lock      sync.Mutex
+	last      HealthCheckResult
+	checkedAt time.Time
+}
+
+// NewHealthRegistry creates a registry without any checks.
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{
+		PassCounterName:  statCounterHealthPass,
+		FailCounterName:  statCounterHealthFail,
+		LatencyTimerName: statTimerHealthCheck,
+		checks:           make(map[string]*healthEntry),
+		stopCh:           make(chan struct{}),
+	}
+}
+
+// Register adds a check to the registry. Names must be unique.
+func (h *HealthRegistry) Register(check HealthCheck) error {
+	if check.Name == "" {
+		return errors.New("health check name must not be empty")
+	}
+	if check.Check == nil {
+		return fmt.Errorf("health check %s has no check function", check.Name)
+	}
+	if check.Timeout < 0 {
+		return fmt.Errorf("health check %s timeout must not be negative but was %s", check.Name, check.Timeout)
+	}
+	if check.Interval < 0 {
+		return fmt.Errorf("health check %s interval must not be negative but was %s", check.Name, check.Interval)
+	}
+	if check.Staleness < 0 {
+		return fmt.Errorf("health check %s staleness must not be negative but was %s", check.Name, check.Staleness)
+	}
+	if check.Interval > 0 && check.Staleness == 0 {
+		check.Staleness = defaultHealthStaleness * check.Interval
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, ok := h.checks[check.Name]; ok {
+		return fmt.Errorf("health check %s is already registered", check.Name)
+	}
+	entry := &healthEntry{check: check}
+	h.checks[check.Name] = entry
+	if h.watching && check.Interval > 0 {
+		go h.poll(entry)
+	}
+	return nil
+}
+
+// Watch runs every background check on its interval until Close is called.
+// Background checks registered while watching are started immediately.
+func (h *HealthRegistry) Watch() {
+	h.lock.Lock()
+	h.watching = true
+	for _, entry := range h.checks {
+		if entry.check.Interval > 0 {
+			go h.poll(entry)
+		}
+	}
+	h.lock.Unlock()
+	<-h.stopCh
+}
+
+// Close the background checks. Close may be called more than once.
+func (h *HealthRegistry) Close() error {
+	h.stopped.Do(func() {
+		close(h.stopCh)
+	})
+	return nil
+}
+
+// poll runs a background check once immediately and then on its interval.
+func (h *HealthRegistry) poll(entry *healthEntry) {
+	ticker := time.NewTicker(entry.check.Interval)
+	defer ticker.Stop()
+	for {
+		result := h.execute(context.Background(), entry.check)
+		entry.lock.Lock()
+		entry.last = result
+		entry.checkedAt = time.Now()
+		entry.lock.Unlock()
+		select {
+		case <-ticker.C:
+		case <-h.stopCh:
+			return
+		}
+	}
+}
+
+// Live runs the liveness checks.
+func (h *HealthRegistry) Live(ctx context.Context) HealthReport {
+	return h.run(ctx, true)
+}
+
+// Ready runs every check.
+func (h *HealthRegistry) Ready(ctx context.Context) HealthReport {
+	return h.run(ctx, false)
+}
+
+// run executes the selected checks concurrently and combines the results.
+func (h *HealthRegistry) run(ctx context.Context, liveness bool) HealthReport {
+	h.lock.RLock()
+	entries := make([]*healthEntry, 0, len(h.checks))
+	for _, entry := range h.checks {
+		if liveness && !entry.check.Liveness {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	h.lock.RUnlock()
+	sort.Slice(entries, func(i int, j int) bool {
+		return entries[i].check.Name < entries[j].check.Name
+	})
+
+	results := make([]HealthCheckResult, len(entries))
+	var wg sync.WaitGroup
+	for offset, entry := range entries {
+		if entry.check.Interval > 0 {
+			results[offset] = entry.cached()
+			continue
+		}
+		wg.Add(1)
+		go func(offset int, check HealthCheck) {
+			defer wg.Done()
+			results[offset] = h.execute(ctx, check)
+		}(offset, entry.check)
+	}
+	wg.Wait()
+
+	report := HealthReport{
+		Status: HealthPass,
+		Checks: make(map[string]HealthCheckResult, len(entries)),
+	}
+	for offset, result := range results {
+		report.Checks[entries[offset].check.Name] = result
+		switch {
+		case result.Status == HealthPass:
+		case result.Critical:
+			report.Status = HealthFail
+		case report.Status == HealthPass:
+			report.Status = HealthWarn
+		}
+	}
+	return report
+}
+
+// cached returns the last result of a background check or a failure if
+// there is no result or the result is stale.
+func (e *healthEntry) cached() HealthCheckResult {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	result := e.last
+	switch {
+	case e.checkedAt.IsZero():
+		result = HealthCheckResult{
+			Status:   HealthFail,
+			Critical: e.check.Critical,
+			Error:    "health check has not completed",
+		}
+	case time.Since(e.checkedAt) > e.check.Staleness:
+		result.Status = HealthFail
+		result.Error = fmt.Sprintf("last result is stale after %s", time.Since(e.checkedAt).Round(time.Millisecond))
+	}
+	return result
+}
+
+// execute runs a check and reports the outcome to the stat client.
+func (h *HealthRegistry) execute(ctx context.Context, check HealthCheck) HealthCheckResult {
+	start := time.Now()
+	result := check.run(ctx)
+	if h.Stat != nil {
+		tag := "check:" + check.Name
+		if result.Status == HealthPass {
+			h.Stat.Count(h.PassCounterName, 1, tag)
+		} else {
+			h.Stat.Count(h.FailCounterName, 1, tag)
+		}
+		h.Stat.Timing(h.LatencyTimerName, time.Since(start), tag)
+	}
+	return result
+}
+
+// run executes the check within its timeout.
+func (c HealthCheck) run(ctx context.Context) HealthCheckResult {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	start := time.Now()
+	// The check runs in the background so that a function that ignores
+	// its context still cannot block the probe beyond the timeout.
+	result := make(chan error, 1)
+	go func() {
+		result <- c.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-result:
+	case <-timer.C:
+		err = context.DeadlineExceeded
+	}
+	out := HealthCheckResult{
+		Status:   HealthPass,
+		Critical: c.Critical,
+		Latency:  time.Since(start).String(),
+	}
+	if err != nil {
+		out.Status = HealthFail
+		out.Error = err.Error()
+	}
+	return out
+}
+
+type healthKey struct{}
+
+// withHealth exposes the health checks of a runtime to request handlers.
+func withHealth(health *HealthRegistry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), healthKey{}, health)))
+		})
+	}
+}
+
+// healthFromContext returns the health checks of the runtime serving a
+// request or nil if there are none.
+func healthFromContext(ctx context.Context) *HealthRegistry {
+	health, _ := ctx.Value(healthKey{}).(*HealthRegistry)
+	return health
+}
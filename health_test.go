@@ -0,0 +1,246 @@
+package runhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func passCheck(context.Context) error {
+	return nil
+}
+
+func failCheck(context.Context) error {
+	return errors.New("unavailable")
+}
+
+func TestHealthRegistryRegister(t *testing.T) {
+	health := NewHealthRegistry()
+	require.Nil(t, health.Register(HealthCheck{Name: "db", Check: passCheck}))
+	require.NotNil(t, health.Register(HealthCheck{Name: "db", Check: passCheck}))
+	require.NotNil(t, health.Register(HealthCheck{Check: passCheck}))
+	require.NotNil(t, health.Register(HealthCheck{Name: "cache"}))
+	require.NotNil(t, health.Register(HealthCheck{Name: "cache", Check: passCheck, Timeout: -time.Second}))
+}
+
+func TestHealthRegistryStatus(t *testing.T) {
+	tc := []struct {
+		name   string
+		checks []HealthCheck
+		status string
+	}{
+		{name: "empty", status: HealthPass},
+		{
+			name:   "pass",
+			checks: []HealthCheck{{Name: "db", Check: passCheck, Critical: true}},
+			status: HealthPass,
+		},
+		{
+			name: "non-critical failure",
+			checks: []HealthCheck{
+				{Name: "db", Check: passCheck, Critical: true},
+				{Name: "cache", Check: failCheck},
+			},
+			status: HealthWarn,
+		},
+		{
+			name: "critical failure",
+			checks: []HealthCheck{
+				{Name: "db", Check: failCheck, Critical: true},
+				{Name: "cache", Check: failCheck},
+			},
+			status: HealthFail,
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			health := NewHealthRegistry()
+			for _, check := range tt.checks {
+				require.Nil(t, health.Register(check))
+			}
+			report := health.Ready(context.Background())
+			require.Equal(t, tt.status, report.Status)
+			require.Len(t, report.Checks, len(tt.checks))
+			require.Equal(t, tt.status != HealthFail, report.Healthy())
+		})
+	}
+}
+
+func TestHealthRegistryLiveness(t *testing.T) {
+	health := NewHealthRegistry()
+	require.Nil(t, health.Register(HealthCheck{Name: "deadlock", Check: passCheck, Critical: true, Liveness: true}))
+	require.Nil(t, health.Register(HealthCheck{Name: "db", Check: failCheck, Critical: true}))
+
+	live := health.Live(context.Background())
+	require.Equal(t, HealthPass, live.Status)
+	require.Len(t, live.Checks, 1)
+	require.Contains(t, live.Checks, "deadlock")
+
+	ready := health.Ready(context.Background())
+	require.Equal(t, HealthFail, ready.Status)
+	require.Len(t, ready.Checks, 2)
+	require.Equal(t, "unavailable", ready.Checks["db"].Error)
+}
+
+func TestHealthRegistryTimeout(t *testing.T) {
+	health := NewHealthRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	require.Nil(t, health.Register(HealthCheck{
+		Name:     "stuck",
+		Critical: true,
+		Timeout:  10 * time.Millisecond,
+		// The check ignores its context so only the timeout ends it.
+		Check: func(context.Context) error {
+			<-release
+			return nil
+		},
+	}))
+	report := health.Ready(context.Background())
+	require.Equal(t, HealthFail, report.Status)
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Checks["stuck"].Error)
+}
+
+func TestHealthRegistryStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	cmp := &HealthComponent{}
+	health, err := cmp.WithStat(stat).New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	require.Nil(t, health.Register(HealthCheck{Name: "db", Check: passCheck}))
+	require.Nil(t, health.Register(HealthCheck{Name: "cache", Check: failCheck}))
+
+	stat.EXPECT().Count(statCounterHealthPass, float64(1), "check:db")
+	stat.EXPECT().Count(statCounterHealthFail, float64(1), "check:cache")
+	stat.EXPECT().Timing(statTimerHealthCheck, gomock.Any(), "check:db")
+	stat.EXPECT().Timing(statTimerHealthCheck, gomock.Any(), "check:cache")
+	_ = health.Ready(context.Background())
+}
+
+func TestHealthRegistryBackground(t *testing.T) {
+	health := NewHealthRegistry()
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	healthy.Store(true)
+	block := make(chan struct{})
+	require.Nil(t, health.Register(HealthCheck{
+		Name:      "db",
+		Critical:  true,
+		Interval:  10 * time.Millisecond,
+		Staleness: 200 * time.Millisecond,
+		Check: func(ctx context.Context) error {
+			calls.Add(1)
+			if !healthy.Load() {
+				// Stop completing so that the cached result becomes stale.
+				<-block
+				return errors.New("unavailable")
+			}
+			return nil
+		},
+	}))
+
+	// There is no result before the background check first completes.
+	report := health.Ready(context.Background())
+	require.Equal(t, HealthFail, report.Status)
+	require.Equal(t, int32(0), calls.Load())
+
+	go health.Watch()
+	require.Eventually(t, func() bool {
+		return health.Ready(context.Background()).Healthy()
+	}, time.Second, 5*time.Millisecond)
+	// Probes report the cached result rather than running the check.
+	before := calls.Load()
+	for probe := 0; probe < 10; probe = probe + 1 {
+		_ = health.Ready(context.Background())
+	}
+	require.Less(t, calls.Load()-before, int32(10))
+
+	healthy.Store(false)
+	require.Eventually(t, func() bool {
+		report := health.Ready(context.Background())
+		return report.Status == HealthFail && report.Checks["db"].Error != ""
+	}, 2*time.Second, 10*time.Millisecond)
+	close(block)
+	require.Nil(t, health.Close())
+	require.Nil(t, health.Close())
+}
+
+func TestHealthCheckHandlerReady(t *testing.T) {
+	health := NewHealthRegistry()
+	var healthy atomic.Bool
+	require.Nil(t, health.Register(HealthCheck{
+		Name:     "db",
+		Critical: true,
+		Check: func(context.Context) error {
+			if healthy.Load() {
+				return nil
+			}
+			return errors.New("unavailable")
+		},
+	}))
+	handler := &HealthCheckHandler{Health: health}
+	probe := func() (int, HealthReport) {
+		w := httptest.NewRecorder()
+		handler.Ready(w, httptest.NewRequest(http.MethodGet, "/healthcheck/ready", nil))
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var report HealthReport
+		require.Nil(t, json.NewDecoder(w.Body).Decode(&report))
+		return w.Code, report
+	}
+
+	code, report := probe()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, HealthFail, report.Checks["db"].Status)
+	require.True(t, report.Checks["db"].Critical)
+	require.NotEmpty(t, report.Checks["db"].Latency)
+
+	healthy.Store(true)
+	code, report = probe()
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, HealthPass, report.Status)
+}
+
+func TestHealthCheckHandlerRuntime(t *testing.T) {
+	rt := newTestRuntime(t)
+	require.NotNil(t, rt.Health)
+	require.Nil(t, rt.Health.Register(HealthCheck{Name: "db", Check: failCheck}))
+	rt.Handler = NewDefaultRouter(&RouterConfig{})
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+	<-rt.Ready()
+
+	resp, err := http.Get("http://" + rt.Addr().String() + "/healthcheck/ready")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var report HealthReport
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&report))
+	require.Equal(t, HealthWarn, report.Status)
+	require.Equal(t, HealthFail, report.Checks["db"].Status)
+
+	rt.Exit <- nil
+	require.Nil(t, <-done)
+}
+
+func TestHealthCheckHandlerDraining(t *testing.T) {
+	var draining atomic.Bool
+	draining.Store(true)
+	handler := withDraining(&draining)(http.HandlerFunc((&HealthCheckHandler{}).Ready))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthcheck/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var report HealthReport
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&report))
+	require.Equal(t, "draining", report.Reason)
+}
@@ -1,13 +1,85 @@
 package runhttp
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+)
 
-// HealthCheckHandler responds with a 200
+// HealthCheckHandler reports the health of a service. The checks are taken
+// from the Health registry or, when it is not set, from the Runtime serving
+// the request.
 type HealthCheckHandler struct {
+	Health *HealthRegistry
 }
 
-// Handle responds with a 200 by default
+// Handle responds with the readiness of the service as plain text for
+// clients of the original endpoint. The status is 200 with Success when the
+// readiness report is healthy and 503 otherwise, such as when a critical
+// check fails or once the runtime serving the request has begun to shut
+// down.
 func (h *HealthCheckHandler) Handle(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("Success"))
+	report := h.readiness(r)
+	switch {
+	case report.Healthy():
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Success"))
+	case isDraining(r.Context()):
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Draining"))
+	case report.Reason != "":
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Not ready: " + report.Reason))
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("Unhealthy"))
+	}
+}
+
+// Live responds with the result of the liveness checks. The status is 503
+// if a critical check failed and 200 otherwise.
+func (h *HealthCheckHandler) Live(w http.ResponseWriter, r *http.Request) {
+	report := HealthReport{Status: HealthPass, Checks: map[string]HealthCheckResult{}}
+	if health := h.health(r); health != nil {
+		report = health.Live(r.Context())
+	}
+	writeHealthReport(w, report)
+}
+
+// Ready responds with the result of every check. The status is 503 if a
+// critical check failed or the runtime serving the request is not ready
+// and 200 otherwise. A runtime is not ready until its start hooks complete,
+// once it begins to shut down, and while marked with SetNotReady.
+func (h *HealthCheckHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, h.readiness(r))
+}
+
+// readiness runs every check and marks the report as failed while the
+// runtime serving the request is not ready.
+func (h *HealthCheckHandler) readiness(r *http.Request) HealthReport {
+	report := HealthReport{Status: HealthPass, Checks: map[string]HealthCheckResult{}}
+	if health := h.health(r); health != nil {
+		report = health.Ready(r.Context())
+	}
+	if reason := notReadyReason(r.Context()); reason != "" {
+		report.Status = HealthFail
+		report.Reason = reason
+	}
+	return report
+}
+
+func (h *HealthCheckHandler) health(r *http.Request) *HealthRegistry {
+	if h.Health != nil {
+		return h.Health
+	}
+	return healthFromContext(r.Context())
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Healthy() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
 }
@@ -1,6 +1,8 @@
 package runhttp
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -21,3 +23,32 @@ func TestHealthCheck(t *testing.T) {
 	handler.Handle(w, r)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestHealthCheckReadiness(t *testing.T) {
+	health := NewHealthRegistry()
+	failing := errors.New("connection refused")
+	assert.Nil(t, health.Register(HealthCheck{Name: "cache", Check: func(context.Context) error { return failing }}))
+	handler := &HealthCheckHandler{Health: health}
+
+	// A failed check that is not critical is only a warning.
+	w := httptest.NewRecorder()
+	handler.Handle(w, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Success", w.Body.String())
+
+	assert.Nil(t, health.Register(HealthCheck{Name: "database", Check: func(context.Context) error { return failing }, Critical: true}))
+	w = httptest.NewRecorder()
+	handler.Handle(w, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "Unhealthy", w.Body.String())
+
+	state := &readiness{}
+	reason := "rebuilding cache"
+	state.reason.Store(&reason)
+	r := httptest.NewRequest(http.MethodGet, "/healthcheck", nil)
+	r = r.WithContext(context.WithValue(r.Context(), readinessKey{}, state))
+	w = httptest.NewRecorder()
+	(&HealthCheckHandler{}).Handle(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "Not ready: rebuilding cache", w.Body.String())
+}
@@ -0,0 +1,91 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type logHookFailed struct {
+	Hook    string `logevent:"hook"`
+	Phase   string `logevent:"phase"`
+	Reason  string `logevent:"reason"`
+	Message string `logevent:"message,default=lifecycle-hook-failed"`
+}
+
+// HookFn is the signature of a lifecycle function. The given context is
+// cancelled when the hook exceeds its timeout or, for OnStart, when the
+// context given to RunContext is cancelled.
+type HookFn func(context.Context) error
+
+// Hook is a pair of optional lifecycle functions that are run by the
+// Runtime. OnStart hooks are run in the order they are given once the
+// server is listening for connections. OnStop hooks are run in reverse
+// order during shutdown, after the server has drained, so that in-flight
+// requests may continue to use any resources managed by the hooks. If an
+// OnStart fails then startup is aborted and only the OnStop of the hooks
+// before it are run.
+type Hook struct {
+	Name    string
+	Timeout time.Duration
+	OnStart HookFn
+	OnStop  HookFn
+}
+
+func (h Hook) run(ctx context.Context, phase string, fn HookFn) error {
+	if fn == nil {
+		return nil
+	}
+	var expired <-chan time.Time
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+		timer := time.NewTimer(h.Timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	// The hook runs in the background so that a function that ignores
+	// its context still cannot block the Runtime beyond the timeout.
+	result := make(chan error, 1)
+	go func() {
+		result <- fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-result:
+	case <-expired:
+		err = context.DeadlineExceeded
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook %s failed: %w", phase, h.Name, err)
+	}
+	return nil
+}
+
+// startHooks runs each OnStart in order and stops at the first failure.
+// The number of hooks that started successfully is returned.
+func (r *Runtime) startHooks(ctx context.Context) (int, error) {
+	for offset, hook := range r.Hooks {
+		if err := hook.run(ctx, "start", hook.OnStart); err != nil {
+			r.Logger.Error(logHookFailed{Hook: hook.Name, Phase: "start", Reason: err.Error()})
+			return offset, err
+		}
+	}
+	return len(r.Hooks), nil
+}
+
+// stopHooks runs the OnStop of the first started hooks in reverse order.
+// Every hook is run regardless of failures and all errors are returned.
+func (r *Runtime) stopHooks(ctx context.Context, started int) error {
+	errs := make([]error, 0, started)
+	for offset := started - 1; offset >= 0; offset = offset - 1 {
+		hook := r.Hooks[offset]
+		if err := hook.run(ctx, "stop", hook.OnStop); err != nil {
+			r.Logger.Error(logHookFailed{Hook: hook.Name, Phase: "stop", Reason: err.Error()})
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/settings/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRuntime creates a Runtime that listens on an ephemeral port, logs
+// and emits stats to nowhere, and exits only when the test sends on Exit.
+func newTestRuntime(t *testing.T, env ...string) *Runtime {
+	t.Helper()
+	env = append([]string{
+		"RUNTIME_HTTPSERVER_ADDRESS=127.0.0.1:0",
+		"RUNTIME_LOGGER_OUTPUT=NULL",
+	}, env...)
+	source, err := settings.NewEnvSource(env)
+	require.Nil(t, err)
+	rt, err := New(context.Background(), source, http.NotFoundHandler())
+	require.Nil(t, err)
+	rt.Exit = make(chan error, 1)
+	t.Cleanup(func() { _ = rt.Close() })
+	return rt
+}
+
+func recordHook(name string, calls *[]string, err error) HookFn {
+	return func(context.Context) error {
+		*calls = append(*calls, name)
+		return err
+	}
+}
+
+func TestRuntimeHooksOrder(t *testing.T) {
+	rt := newTestRuntime(t)
+	var calls []string
+	rt.Hooks = []Hook{
+		{Name: "a", OnStart: recordHook("start-a", &calls, nil), OnStop: recordHook("stop-a", &calls, nil)},
+		{Name: "b", OnStart: recordHook("start-b", &calls, nil)},
+		{Name: "c", OnStop: recordHook("stop-c", &calls, nil)},
+		{Name: "d", OnStart: func(context.Context) error {
+			calls = append(calls, "start-d")
+			rt.Exit <- nil
+			return nil
+		}},
+	}
+	require.Nil(t, rt.Run())
+	require.Equal(t, []string{"start-a", "start-b", "start-d", "stop-c", "stop-a"}, calls)
+}
+
+func TestRuntimeHooksStartFailure(t *testing.T) {
+	rt := newTestRuntime(t)
+	var calls []string
+	failure := errors.New("failed")
+	rt.Hooks = []Hook{
+		{Name: "a", OnStart: recordHook("start-a", &calls, nil), OnStop: recordHook("stop-a", &calls, nil)},
+		{Name: "b", OnStart: recordHook("start-b", &calls, failure), OnStop: recordHook("stop-b", &calls, nil)},
+		{Name: "c", OnStart: recordHook("start-c", &calls, nil), OnStop: recordHook("stop-c", &calls, nil)},
+	}
+	err := rt.Run()
+	require.ErrorIs(t, err, failure)
+	require.Equal(t, []string{"start-a", "start-b", "stop-a"}, calls)
+}
+
+func TestRuntimeHooksStopFailureAndTimeout(t *testing.T) {
+	rt := newTestRuntime(t)
+	failure := errors.New("failed")
+	rt.Hooks = []Hook{
+		{Name: "a", OnStop: func(context.Context) error { return failure }},
+		{Name: "b", Timeout: 10 * time.Millisecond, OnStop: func(context.Context) error {
+			select {}
+		}},
+	}
+	rt.Exit <- nil
+	err := rt.Run()
+	require.ErrorIs(t, err, failure)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -2,13 +2,36 @@ package runhttp
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	defaultAddress            = ":8080"
+	defaultReadTimeout        = time.Minute
+	defaultReadHeaderTimeout  = 10 * time.Second
+	defaultWriteTimeout       = time.Minute
+	defaultIdleTimeout        = 2 * time.Minute
+	defaultMaxHeaderBytes     = http.DefaultMaxHeaderBytes
+	defaultMaxRequestsPerConn = 0
+)
+
 // HTTPConfig is the container for HTTP server configuration settings.
 type HTTPConfig struct {
-	Address string `description:"The listening address of the server."`
+	Address            string        `description:"The listening address of the server. One of host:port, unix:///path/to/socket, fd://N, or systemd://name."`
+	SocketMode         string        `description:"Octal file permissions applied to a unix socket, such as 0660. Empty leaves the default permissions."`
+	ReadTimeout        time.Duration `description:"Maximum duration for reading an entire request, including the body. Zero disables the timeout."`
+	ReadHeaderTimeout  time.Duration `description:"Maximum duration for reading request headers. Must not exceed the read timeout. Zero uses 10s."`
+	WriteTimeout       time.Duration `description:"Maximum duration before timing out writes of a response. Zero disables the timeout."`
+	IdleTimeout        time.Duration `description:"Maximum duration to wait for the next request on a keep-alive connection."`
+	MaxHeaderBytes     int           `description:"Maximum number of bytes read while parsing request headers."`
+	DisableKeepAlives  bool          `description:"Whether HTTP keep-alive connections are disabled so that each connection serves a single request."`
+	MaxRequestsPerConn int           `description:"Maximum number of requests served on a single HTTP/1.x connection before it is closed. Zero is unlimited."`
+	TLS                *TLSConfig
 }
 
 // Name returns the configuration root as it would appear in a config file.
@@ -21,20 +44,161 @@ func (*HTTPConfig) Description() string {
 	return "HTTP server configuration."
 }
 
+// Validate checks the configuration for values that would produce a
+// broken or unsafe server.
+func (c *HTTPConfig) Validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("httpserver address must not be empty")
+	}
+	if _, err := parseAddress(c.Address); err != nil {
+		return fmt.Errorf("httpserver address is invalid: %w", err)
+	}
+	if _, err := parseSocketMode(c.SocketMode); err != nil {
+		return fmt.Errorf("httpserver socketmode is invalid: %w", err)
+	}
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{name: "readtimeout", value: c.ReadTimeout},
+		{name: "readheadertimeout", value: c.ReadHeaderTimeout},
+		{name: "writetimeout", value: c.WriteTimeout},
+		{name: "idletimeout", value: c.IdleTimeout},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			return fmt.Errorf("httpserver %s must not be negative but was %s", d.name, d.value)
+		}
+	}
+	if c.ReadTimeout > 0 && c.ReadHeaderTimeout > c.ReadTimeout {
+		return fmt.Errorf(
+			"httpserver readheadertimeout %s must not exceed readtimeout %s",
+			c.ReadHeaderTimeout, c.ReadTimeout,
+		)
+	}
+	if c.MaxHeaderBytes < 0 {
+		return fmt.Errorf("httpserver maxheaderbytes must not be negative but was %d", c.MaxHeaderBytes)
+	}
+	if c.MaxRequestsPerConn < 0 {
+		return fmt.Errorf("httpserver maxrequestsperconn must not be negative but was %d", c.MaxRequestsPerConn)
+	}
+	return nil
+}
+
 // HTTPComponent implements the settings.Component interface for the HTTP server.
-type HTTPComponent struct{}
+type HTTPComponent struct {
+	TLS *TLSComponent
+}
+
+// NewHTTPComponent populates the component with some default values.
+func NewHTTPComponent() *HTTPComponent {
+	return &HTTPComponent{
+		TLS: &TLSComponent{},
+	}
+}
 
 // Settings returns a configuration with all defaults set.
-func (*HTTPComponent) Settings() *HTTPConfig {
+func (c *HTTPComponent) Settings() *HTTPConfig {
 	return &HTTPConfig{
-		Address: ":8080",
+		Address:            defaultAddress,
+		ReadTimeout:        defaultReadTimeout,
+		ReadHeaderTimeout:  defaultReadHeaderTimeout,
+		WriteTimeout:       defaultWriteTimeout,
+		IdleTimeout:        defaultIdleTimeout,
+		MaxHeaderBytes:     defaultMaxHeaderBytes,
+		MaxRequestsPerConn: defaultMaxRequestsPerConn,
+		TLS:                c.TLS.Settings(),
 	}
 }
 
-// New produces a ServerFn bound to the given configuration.
-func (*HTTPComponent) New(_ context.Context, conf *HTTPConfig) (*http.Server, error) {
-	return &http.Server{
-		Addr:              conf.Address,
-		ReadHeaderTimeout: 10 * time.Second,
+// New produces a server bound to the given configuration.
+func (c *HTTPComponent) New(ctx context.Context, conf *HTTPConfig) (*http.Server, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConf, err := c.TLS.New(ctx, conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return newServer(conf, tlsConf), nil
+}
+
+// NewHosted produces a HostedServer bound to the given configuration. When
+// certificate reloading is enabled the reloads are reported to the given
+// Logger and Stat.
+func (c *HTTPComponent) NewHosted(ctx context.Context, conf *HTTPConfig, logger Logger, stat Stat) (*HostedServer, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConf, err := c.TLS.New(ctx, conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	var certs *CertificateManager
+	if tlsConf != nil && conf.TLS.ReloadInterval > 0 {
+		certs, err = NewCertificateManager(conf.TLS, logger, stat)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = nil
+		tlsConf.GetCertificate = certs.GetCertificate
+	}
+	return &HostedServer{
+		Server: func() *http.Server {
+			return newServer(conf, tlsConf)
+		},
+		Listen:       c.Listener(conf),
+		Certificates: certs,
 	}, nil
 }
+
+// newServer creates a server from a validated configuration.
+func newServer(conf *HTTPConfig, tlsConf *tls.Config) *http.Server {
+	// A server never waits indefinitely for the headers of a request.
+	readHeaderTimeout := conf.ReadHeaderTimeout
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = defaultReadHeaderTimeout
+	}
+	server := &http.Server{
+		Addr:              conf.Address,
+		ReadTimeout:       conf.ReadTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+		TLSConfig:         tlsConf,
+	}
+	server.SetKeepAlivesEnabled(!conf.DisableKeepAlives)
+	if conf.MaxRequestsPerConn > 0 {
+		server.ConnContext = connRequestLimit(conf.MaxRequestsPerConn)
+	}
+	return server
+}
+
+type connRequestsKey struct{}
+
+type connRequests struct {
+	max   int64
+	count atomic.Int64
+}
+
+// connRequestLimit attaches a request counter to each new connection.
+func connRequestLimit(max int) func(context.Context, net.Conn) context.Context {
+	return func(ctx context.Context, _ net.Conn) context.Context {
+		return context.WithValue(ctx, connRequestsKey{}, &connRequests{max: int64(max)})
+	}
+}
+
+// closeAfterMaxRequests asks the server to close a connection once it has
+// served its maximum number of requests. It has no effect on connections
+// that have no request limit.
+func closeAfterMaxRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit, ok := r.Context().Value(connRequestsKey{}).(*connRequests); ok {
+			if limit.count.Add(1) >= limit.max {
+				w.Header().Set("Connection", "close")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,114 @@
+package runhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPComponentDefaults(t *testing.T) {
+	cmp := NewHTTPComponent()
+	server, err := cmp.New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	require.Equal(t, defaultAddress, server.Addr)
+	require.Equal(t, defaultReadTimeout, server.ReadTimeout)
+	require.Equal(t, defaultReadHeaderTimeout, server.ReadHeaderTimeout)
+	require.Equal(t, defaultWriteTimeout, server.WriteTimeout)
+	require.Equal(t, defaultIdleTimeout, server.IdleTimeout)
+	require.Equal(t, defaultMaxHeaderBytes, server.MaxHeaderBytes)
+	require.Nil(t, server.ConnContext)
+	require.Nil(t, server.TLSConfig)
+}
+
+func TestHTTPComponentWithoutTLS(t *testing.T) {
+	server, err := (&HTTPComponent{}).New(context.Background(), &HTTPConfig{Address: defaultAddress})
+	require.Nil(t, err)
+	require.Nil(t, server.TLSConfig)
+
+	hosted, err := (&HTTPComponent{}).NewHosted(context.Background(), &HTTPConfig{Address: defaultAddress}, nil, nil)
+	require.Nil(t, err)
+	require.Nil(t, hosted.Certificates)
+	require.Nil(t, hosted.Server().TLSConfig)
+}
+
+func TestHTTPComponentValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*HTTPConfig)
+	}{
+		{name: "empty address", modify: func(c *HTTPConfig) { c.Address = "" }},
+		{name: "negative read timeout", modify: func(c *HTTPConfig) { c.ReadTimeout = -time.Second }},
+		{name: "negative header timeout", modify: func(c *HTTPConfig) { c.ReadHeaderTimeout = -time.Second }},
+		{name: "negative write timeout", modify: func(c *HTTPConfig) { c.WriteTimeout = -time.Second }},
+		{name: "negative idle timeout", modify: func(c *HTTPConfig) { c.IdleTimeout = -time.Second }},
+		{name: "header timeout exceeds read", modify: func(c *HTTPConfig) { c.ReadHeaderTimeout = 2 * c.ReadTimeout }},
+		{name: "negative header bytes", modify: func(c *HTTPConfig) { c.MaxHeaderBytes = -1 }},
+		{name: "negative max requests", modify: func(c *HTTPConfig) { c.MaxRequestsPerConn = -1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmp := NewHTTPComponent()
+			conf := cmp.Settings()
+			tt.modify(conf)
+			_, err := cmp.New(context.Background(), conf)
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestHTTPComponentMaxRequestsPerConn(t *testing.T) {
+	cmp := NewHTTPComponent()
+	conf := cmp.Settings()
+	conf.MaxRequestsPerConn = 2
+	server, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+
+	srv := httptest.NewUnstartedServer(closeAfterMaxRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	srv.Config.ConnContext = server.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	client := srv.Client()
+	first, err := client.Get(srv.URL)
+	require.Nil(t, err)
+	first.Body.Close()
+	require.False(t, first.Close)
+	second, err := client.Get(srv.URL)
+	require.Nil(t, err)
+	second.Body.Close()
+	require.True(t, second.Close)
+}
+
+func TestHTTPComponentKeepAlives(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  *HTTPConfig
+		close bool
+	}{
+		{name: "zero value", conf: &HTTPConfig{Address: defaultAddress}},
+		{name: "disabled", conf: &HTTPConfig{Address: defaultAddress, DisableKeepAlives: true}, close: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := (&HTTPComponent{}).New(context.Background(), tt.conf)
+			require.Nil(t, err)
+			require.Equal(t, defaultReadHeaderTimeout, server.ReadHeaderTimeout)
+
+			server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			srv := httptest.NewUnstartedServer(nil)
+			srv.Config = server
+			srv.Start()
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL)
+			require.Nil(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.close, resp.Close)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package runhttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	schemeUnix    = "unix://"
+	schemeFD      = "fd://"
+	schemeSystemd = "systemd://"
+
+	// systemdFDStart is the first file descriptor passed by socket
+	// activation. Descriptors 0 through 2 are the standard streams.
+	systemdFDStart = 3
+)
+
+// address is the parsed form of a configured listening address.
+type address struct {
+	network string
+	target  string
+	fd      int
+}
+
+// parseAddress interprets the supported address forms:
+//
+//	host:port           a TCP address
+//	unix:///path/sock   a unix domain socket
+//	fd://3              an inherited file descriptor
+//	systemd://name      a socket passed by systemd socket activation
+func parseAddress(addr string) (address, error) {
+	switch {
+	case strings.HasPrefix(addr, schemeUnix):
+		path := strings.TrimPrefix(addr, schemeUnix)
+		if path == "" {
+			return address{}, fmt.Errorf("unix address %q has no socket path", addr)
+		}
+		return address{network: "unix", target: path}, nil
+	case strings.HasPrefix(addr, schemeFD):
+		fd, err := strconv.Atoi(strings.TrimPrefix(addr, schemeFD))
+		if err != nil || fd < 0 {
+			return address{}, fmt.Errorf("fd address %q does not name a file descriptor", addr)
+		}
+		return address{network: "fd", target: addr, fd: fd}, nil
+	case strings.HasPrefix(addr, schemeSystemd):
+		name := strings.TrimPrefix(addr, schemeSystemd)
+		if name == "" {
+			return address{}, fmt.Errorf("systemd address %q has no socket name", addr)
+		}
+		return address{network: "systemd", target: name}, nil
+	}
+	return address{network: "tcp", target: addr}, nil
+}
+
+// parseSocketMode converts an octal permission string such as 0660. An
+// empty string leaves the permissions of a socket unchanged and returns
+// zero.
+func parseSocketMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 0777 {
+		return 0, fmt.Errorf("socket mode %q is not an octal file permission", mode)
+	}
+	return os.FileMode(value), nil
+}
+
+// Listener produces a ListenerFn bound to the given configuration. The
+// configuration is expected to have passed validation.
+func (c *HTTPComponent) Listener(conf *HTTPConfig) ListenerFn {
+	return func() (net.Listener, error) {
+		addr, err := parseAddress(conf.Address)
+		if err != nil {
+			return nil, err
+		}
+		switch addr.network {
+		case "unix":
+			var mode os.FileMode
+			mode, err = parseSocketMode(conf.SocketMode)
+			if err != nil {
+				return nil, err
+			}
+			return listenUnix(addr.target, mode)
+		case "fd":
+			return listenFD(addr.fd, addr.target)
+		case "systemd":
+			var fd int
+			fd, err = systemdFD(addr.target, os.Getenv, os.Getpid())
+			if err != nil {
+				return nil, err
+			}
+			return listenFD(fd, schemeSystemd+addr.target)
+		}
+		return net.Listen("tcp", addr.target)
+	}
+}
+
+// listenUnix creates a unix domain socket at the given path. A socket file
+// left behind by a process that did not exit cleanly is removed but a
+// socket that still accepts connections is left alone.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, statErr := os.Lstat(path); statErr == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unix socket path %s exists and is not a socket", path)
+		}
+		if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("unix socket %s is in use by another process", path)
+		}
+		if removeErr := os.Remove(path); removeErr != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket %s: %w", path, removeErr)
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err = os.Chmod(path, mode); err != nil {
+			_ = listener.Close()
+			return nil, fmt.Errorf("failed to set mode of unix socket %s: %w", path, err)
+		}
+	}
+	return listener, nil
+}
+
+// inheritedFiles holds each inherited file descriptor open for the life of
+// the process. A listener is created from a duplicate of the descriptor on
+// every run so that closing the listener when a run ends leaves the socket
+// open for the next run. The descriptor is never closed so its number can
+// not be reused by an unrelated file.
+var (
+	inheritedLock  sync.Mutex
+	inheritedFiles = make(map[int]*os.File)
+)
+
+// listenFD creates a listener from an inherited file descriptor.
+func listenFD(fd int, name string) (net.Listener, error) {
+	inheritedLock.Lock()
+	defer inheritedLock.Unlock()
+	f, ok := inheritedFiles[fd]
+	if !ok {
+		f = os.NewFile(uintptr(fd), name)
+		if f == nil {
+			return nil, fmt.Errorf("file descriptor %d for %s is not valid", fd, name)
+		}
+		inheritedFiles[fd] = f
+	}
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d for %s is not a listening socket: %w", fd, name, err)
+	}
+	return listener, nil
+}
+
+// systemdFD finds the file descriptor of a named socket using the socket
+// activation protocol. LISTEN_PID must match the current process,
+// LISTEN_FDS holds the number of descriptors passed starting at 3, and
+// LISTEN_FDNAMES holds a colon separated name for each descriptor.
+func systemdFD(name string, getenv func(string) string, pid int) (int, error) {
+	listenPID, err := strconv.Atoi(getenv("LISTEN_PID"))
+	if err != nil || listenPID != pid {
+		return 0, errors.New("no sockets were passed to this process by systemd")
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return 0, errors.New("no sockets were passed to this process by systemd")
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+	for offset := 0; offset < count && offset < len(names); offset = offset + 1 {
+		if names[offset] == name {
+			return systemdFDStart + offset, nil
+		}
+	}
+	return 0, fmt.Errorf("no socket named %s was passed to this process by systemd", name)
+}
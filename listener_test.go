@@ -0,0 +1,184 @@
+package runhttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    address
+		wantErr bool
+	}{
+		{name: "tcp", address: "localhost:8080", want: address{network: "tcp", target: "localhost:8080"}},
+		{name: "unix", address: "unix:///tmp/app.sock", want: address{network: "unix", target: "/tmp/app.sock"}},
+		{name: "unix empty", address: "unix://", wantErr: true},
+		{name: "fd", address: "fd://3", want: address{network: "fd", target: "fd://3", fd: 3}},
+		{name: "fd invalid", address: "fd://three", wantErr: true},
+		{name: "fd negative", address: "fd://-1", wantErr: true},
+		{name: "systemd", address: "systemd://http", want: address{network: "systemd", target: "http"}},
+		{name: "systemd empty", address: "systemd://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAddress(tt.address)
+			if tt.wantErr {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSocketMode(t *testing.T) {
+	mode, err := parseSocketMode("")
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0), mode)
+	mode, err = parseSocketMode("0660")
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0660), mode)
+	_, err = parseSocketMode("0999")
+	require.NotNil(t, err)
+	_, err = parseSocketMode("01777")
+	require.NotNil(t, err)
+}
+
+func TestListenerUnix(t *testing.T) {
+	// Socket paths are limited in length so the test directory, which
+	// includes the test name, may be too long on some systems.
+	dir, err := os.MkdirTemp("", "runhttp")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	cmp := NewHTTPComponent()
+	conf := cmp.Settings()
+	conf.Address = "unix://" + path
+	conf.SocketMode = "0600"
+	require.Nil(t, conf.Validate())
+
+	// A socket file left behind by a previous process is replaced.
+	stale, err := net.Listen("unix", path)
+	require.Nil(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.Nil(t, stale.Close())
+
+	listener, err := cmp.Listener(conf)()
+	require.Nil(t, err)
+	defer listener.Close()
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A socket that is still in use is left alone.
+	_, err = cmp.Listener(conf)()
+	require.NotNil(t, err)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestListenerUnixNotSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	require.Nil(t, os.WriteFile(path, nil, 0600))
+	_, err := listenUnix(path, 0)
+	require.NotNil(t, err)
+}
+
+func TestListenerFD(t *testing.T) {
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer inherited.Close()
+	f, err := inherited.(*net.TCPListener).File()
+	require.Nil(t, err)
+	// The listener takes ownership of the descriptor so it is given a
+	// copy that no *os.File will close again.
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	cmp := NewHTTPComponent()
+	conf := cmp.Settings()
+	conf.Address = "fd://" + strconv.Itoa(fd)
+	require.Nil(t, conf.Validate())
+	listener, err := cmp.Listener(conf)()
+	require.Nil(t, err)
+	defer listener.Close()
+	require.Equal(t, inherited.Addr().String(), listener.Addr().String())
+}
+
+func TestSystemdFD(t *testing.T) {
+	env := map[string]string{
+		"LISTEN_PID":     "42",
+		"LISTEN_FDS":     "2",
+		"LISTEN_FDNAMES": "admin:http",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	fd, err := systemdFD("http", getenv, 42)
+	require.Nil(t, err)
+	require.Equal(t, 4, fd)
+	fd, err = systemdFD("admin", getenv, 42)
+	require.Nil(t, err)
+	require.Equal(t, 3, fd)
+
+	_, err = systemdFD("missing", getenv, 42)
+	require.NotNil(t, err)
+	_, err = systemdFD("http", getenv, 43)
+	require.NotNil(t, err)
+	env["LISTEN_FDS"] = "1"
+	_, err = systemdFD("http", getenv, 42)
+	require.NotNil(t, err)
+}
+
+func TestRuntimeListenerFDRepeatedly(t *testing.T) {
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer inherited.Close()
+	f, err := inherited.(*net.TCPListener).File()
+	require.Nil(t, err)
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	rt := newTestRuntime(t, "RUNTIME_HTTPSERVER_ADDRESS=fd://"+strconv.Itoa(fd))
+	for run := 0; run < 2; run = run + 1 {
+		done := make(chan error, 1)
+		go func() {
+			done <- rt.Run()
+		}()
+		select {
+		case <-rt.Ready():
+		case err = <-done:
+			t.Fatalf("run %d failed: %v", run, err)
+		}
+		require.Equal(t, inherited.Addr().String(), rt.Addr().String())
+		resp, err := http.Get("http://" + rt.Addr().String())
+		require.Nil(t, err)
+		resp.Body.Close()
+		rt.Exit <- nil
+		require.Nil(t, <-done)
+	}
+}
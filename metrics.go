@@ -0,0 +1,139 @@
+package runhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	statCounterRequest        = "http.server.request"
+	statTimerRequest          = "http.server.request.latency"
+	statHistogramRequestSize  = "http.server.request.size"
+	statHistogramResponseSize = "http.server.response.size"
+	statGaugeRequestsInFlight = "http.server.request.inflight"
+	unmatchedRoute            = "unmatched"
+	otherMethod               = "other"
+)
+
+// MetricsConfig is the container for request metric settings.
+type MetricsConfig struct {
+	Enabled               bool   `description:"Whether metrics are emitted for each request."`
+	RequestCounter        string `description:"Name of the counter metric tracking requests."`
+	LatencyTimer          string `description:"Name of the timing metric tracking request latency."`
+	RequestSizeHistogram  string `description:"Name of the histogram metric tracking request body sizes."`
+	ResponseSizeHistogram string `description:"Name of the histogram metric tracking response body sizes."`
+	InFlightGauge         string `description:"Name of the gauge metric tracking requests in flight."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*MetricsConfig) Name() string {
+	return "metrics"
+}
+
+// Description returns the help information for the configuration root.
+func (*MetricsConfig) Description() string {
+	return "Request metric configuration."
+}
+
+// Metrics emits a set of metrics for each request. The count, latency,
+// and sizes of requests are tagged with the method, the status class, such
+// as 2xx, and the route pattern matched by a chi router. The raw path is
+// never used and methods other than the standard ones are tagged as other
+// so that the number of tag values stays bounded. Requests not routed by
+// chi are tagged with the route unmatched.
+type Metrics struct {
+	Stat                      Stat
+	RequestCounterName        string
+	LatencyTimerName          string
+	RequestSizeHistogramName  string
+	ResponseSizeHistogramName string
+	InFlightGaugeName         string
+	inFlight                  atomic.Int64
+}
+
+// MetricsComponent implements the settings.Component interface for
+// request metrics.
+type MetricsComponent struct {
+	Stat Stat
+}
+
+// WithStat returns a copy of the component that emits metrics through the
+// given stat client.
+func (c *MetricsComponent) WithStat(stat Stat) *MetricsComponent {
+	n := *c
+	n.Stat = stat
+	return &n
+}
+
+// Settings returns a configuration with all defaults set.
+func (*MetricsComponent) Settings() *MetricsConfig {
+	return &MetricsConfig{
+		Enabled:               true,
+		RequestCounter:        statCounterRequest,
+		LatencyTimer:          statTimerRequest,
+		RequestSizeHistogram:  statHistogramRequestSize,
+		ResponseSizeHistogram: statHistogramResponseSize,
+		InFlightGauge:         statGaugeRequestsInFlight,
+	}
+}
+
+// New produces Metrics bound to the given configuration. The result is nil
+// when request metrics are not enabled.
+func (c *MetricsComponent) New(_ context.Context, conf *MetricsConfig) (*Metrics, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+	return &Metrics{
+		Stat:                      c.Stat,
+		RequestCounterName:        conf.RequestCounter,
+		LatencyTimerName:          conf.LatencyTimer,
+		RequestSizeHistogramName:  conf.RequestSizeHistogram,
+		ResponseSizeHistogramName: conf.ResponseSizeHistogram,
+		InFlightGaugeName:         conf.InFlightGauge,
+	}, nil
+}
+
+// Middleware wraps a handler so that its requests are measured.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.Stat.Gauge(m.InFlightGaugeName, float64(m.inFlight.Add(1)))
+		defer func() {
+			m.Stat.Gauge(m.InFlightGaugeName, float64(m.inFlight.Add(-1)))
+		}()
+		body := countBody(r)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := routePattern(r)
+		if route == "" {
+			route = unmatchedRoute
+		}
+		tags := []string{
+			methodTag(r.Method),
+			fmt.Sprintf("status:%dxx", responseStatus(ww)/100),
+			"route:" + route,
+		}
+		m.Stat.Count(m.RequestCounterName, 1, tags...)
+		m.Stat.Timing(m.LatencyTimerName, time.Since(start), tags...)
+		m.Stat.Histogram(m.RequestSizeHistogramName, float64(body.count.Load()), tags...)
+		m.Stat.Histogram(m.ResponseSizeHistogramName, float64(ww.BytesWritten()), tags...)
+	})
+}
+
+// methodTag returns the tag for the method of a request. Any method that is
+// not defined by net/http is tagged as other because clients may send
+// arbitrary methods.
+func methodTag(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return "method:" + method
+	}
+	return "method:" + otherMethod
+}
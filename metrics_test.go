@@ -0,0 +1,87 @@
+package runhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	cmp := &MetricsComponent{}
+	metrics, err := cmp.WithStat(stat).New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+
+	router := chi.NewRouter()
+	router.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = r.Body.Read(make([]byte, 16))
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("accepted"))
+	})
+	handler := withRouteContext(router)(metrics.Middleware(router))
+
+	tags := []interface{}{"method:POST", "status:2xx", "route:/users/{id}"}
+	gomock.InOrder(
+		stat.EXPECT().Gauge(statGaugeRequestsInFlight, float64(1)),
+		stat.EXPECT().Count(statCounterRequest, float64(1), tags...),
+		stat.EXPECT().Timing(statTimerRequest, gomock.Any(), tags...),
+		stat.EXPECT().Histogram(statHistogramRequestSize, float64(len("payload")), tags...),
+		stat.EXPECT().Histogram(statHistogramResponseSize, float64(len("accepted")), tags...),
+		stat.EXPECT().Gauge(statGaugeRequestsInFlight, float64(0)),
+	)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader("payload")))
+	require.Equal(t, http.StatusAccepted, w.Code)
+}
+
+func TestMetricsUnmatchedRoute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	cmp := &MetricsComponent{}
+	metrics, err := cmp.WithStat(stat).New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	handler := metrics.Middleware(http.NotFoundHandler())
+
+	tags := []interface{}{"method:GET", "status:4xx", "route:" + unmatchedRoute}
+	stat.EXPECT().Gauge(statGaugeRequestsInFlight, gomock.Any()).Times(2)
+	stat.EXPECT().Count(statCounterRequest, float64(1), tags...)
+	stat.EXPECT().Timing(statTimerRequest, gomock.Any(), tags...)
+	stat.EXPECT().Histogram(gomock.Any(), gomock.Any(), tags...).Times(2)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+}
+
+func TestMetricsNonStandardMethod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	cmp := &MetricsComponent{}
+	metrics, err := cmp.WithStat(stat).New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	handler := metrics.Middleware(http.NotFoundHandler())
+
+	tags := []interface{}{"method:other", "status:4xx", "route:" + unmatchedRoute}
+	stat.EXPECT().Gauge(statGaugeRequestsInFlight, gomock.Any()).Times(4)
+	stat.EXPECT().Count(statCounterRequest, float64(1), tags...).Times(2)
+	stat.EXPECT().Timing(statTimerRequest, gomock.Any(), tags...).Times(2)
+	stat.EXPECT().Histogram(gomock.Any(), gomock.Any(), tags...).Times(4)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/users/42", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("get", "/users/42", nil))
+}
+
+func TestMetricsComponentDisabled(t *testing.T) {
+	cmp := &MetricsComponent{}
+	conf := cmp.Settings()
+	conf.Enabled = false
+	metrics, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.Nil(t, metrics)
+}
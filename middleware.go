@@ -0,0 +1,73 @@
+package runhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// withRouteContext installs an empty chi routing context in each request
+// unless one is already present. A chi router given a request with a
+// routing context uses it rather than creating its own, which allows the
+// middleware of the runtime to see the matched route pattern once the
+// request is handled. The handler is recorded as the routes of the context
+// when it is a chi router.
+func withRouteContext(handler http.Handler) func(http.Handler) http.Handler {
+	routes, _ := handler.(chi.Routes)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if chi.RouteContext(r.Context()) == nil {
+				rctx := chi.NewRouteContext()
+				rctx.Routes = routes
+				r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routePattern returns the route pattern matched by a chi router for the
+// request or an empty string if the request was not routed by chi.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+	return rctx.RoutePattern()
+}
+
+// responseStatus returns the status written through the wrapped writer. A
+// handler that writes nothing results in a 200 from net/http.
+func responseStatus(w middleware.WrapResponseWriter) int {
+	if status := w.Status(); status != 0 {
+		return status
+	}
+	return http.StatusOK
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	count atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.count.Add(int64(n))
+	return n, err
+}
+
+// countBody replaces the body of the request with one that counts the
+// bytes read by the handler.
+func countBody(r *http.Request) *countingBody {
+	body := &countingBody{ReadCloser: r.Body}
+	if r.Body == nil {
+		body.ReadCloser = http.NoBody
+	}
+	r.Body = body
+	return body
+}
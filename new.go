@@ -14,3 +14,57 @@ func New(ctx context.Context, s settings.Source, h http.Handler) (*Runtime, erro
 	err := settings.NewComponent(ctx, s, rt, runnerDst)
 	return runnerDst, err
 }
+
+// NewWithServers uses the given source to generate a configured Runtime
+// instance that runs a server for each of the named handlers in addition
+// to the main server. Each named server is configured by the HTTP settings
+// found under runtime.servers.<name> in the source.
+func NewWithServers(ctx context.Context, s settings.Source, h http.Handler, servers map[string]http.Handler) (*Runtime, error) {
+	cmp := NewComponent().WithHandler(h).WithServers(servers)
+	conf := cmp.Settings()
+	serverConfs := cmp.ServerSettings()
+	g, err := settings.Convert(conf)
+	if err != nil {
+		return nil, err
+	}
+	// The settings library cannot describe a map of groups so a group is
+	// added to the tree for each named server before the source is loaded.
+	serverGroups := &settings.SettingGroup{
+		NameValue:        "servers",
+		DescriptionValue: "Named HTTP server configurations.",
+	}
+	for name, serverConf := range serverConfs {
+		var sg settings.Group
+		sg, err = settings.Convert(serverConf)
+		if err != nil {
+			return nil, err
+		}
+		serverGroups.GroupValues = append(serverGroups.GroupValues, &renamedGroup{Group: sg, name: name})
+	}
+	root := &extendedGroup{Group: g, extra: []settings.Group{serverGroups}}
+	err = settings.LoadGroups(ctx, s, []settings.Group{root})
+	if err != nil {
+		return nil, err
+	}
+	return cmp.NewWithServers(ctx, conf, serverConfs)
+}
+
+// renamedGroup is a settings group under a different name.
+type renamedGroup struct {
+	settings.Group
+	name string
+}
+
+func (g *renamedGroup) Name() string {
+	return g.name
+}
+
+// extendedGroup is a settings group with additional sub-groups.
+type extendedGroup struct {
+	settings.Group
+	extra []settings.Group
+}
+
+func (g *extendedGroup) Groups() []settings.Group {
+	return append(append([]settings.Group(nil), g.Group.Groups()...), g.extra...)
+}
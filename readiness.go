@@ -0,0 +1,69 @@
+package runhttp
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+const readinessStarting = "starting"
+
+// readiness is the state of a Runtime, other than draining, that is
+// reported by the readiness endpoint.
+type readiness struct {
+	starting atomic.Bool
+	reason   atomic.Pointer[string]
+}
+
+// notReady returns the reason the runtime is not ready or an empty string
+// if it is ready.
+func (s *readiness) notReady() string {
+	if s.starting.Load() {
+		return readinessStarting
+	}
+	if reason := s.reason.Load(); reason != nil {
+		return *reason
+	}
+	return ""
+}
+
+// SetReady clears the reason given to SetNotReady. The readiness endpoint
+// then reports the state of the Runtime and its health checks.
+func (r *Runtime) SetReady() {
+	r.readiness.reason.Store(nil)
+}
+
+// SetNotReady makes the readiness endpoint fail with the given reason until
+// SetReady is called. This is useful to take a running service out of
+// rotation, for example while a cache is rebuilt, without shutting down.
+func (r *Runtime) SetNotReady(reason string) {
+	if reason == "" {
+		reason = "not ready"
+	}
+	r.readiness.reason.Store(&reason)
+}
+
+type readinessKey struct{}
+
+// withReadiness exposes the readiness state of a runtime to request
+// handlers.
+func withReadiness(state *readiness) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), readinessKey{}, state)))
+		})
+	}
+}
+
+// notReadyReason returns the reason the runtime serving a request is not
+// ready or an empty string if it is ready.
+func notReadyReason(ctx context.Context) string {
+	if isDraining(ctx) {
+		return "draining"
+	}
+	state, ok := ctx.Value(readinessKey{}).(*readiness)
+	if !ok {
+		return ""
+	}
+	return state.notReady()
+}
@@ -0,0 +1,85 @@
+package runhttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func getReadiness(t *testing.T, addr string) (int, HealthReport) {
+	t.Helper()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://" + addr + "/healthcheck/ready")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	var report HealthReport
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&report))
+	return resp.StatusCode, report
+}
+
+func TestRuntimeReadinessLifecycle(t *testing.T) {
+	rt := newTestRuntime(t, "RUNTIME_SHUTDOWN_PREDRAINDELAY=200ms")
+	// Requests are sent while the runtime logs its shutdown. The mock
+	// avoids the global state written by copies of the default logger.
+	ctrl := gomock.NewController(t)
+	logger := NewMockLogger(ctrl)
+	logger.EXPECT().Copy().Return(logger).AnyTimes()
+	logger.EXPECT().Info(gomock.Any()).AnyTimes()
+	logger.EXPECT().SetField(gomock.Any(), gomock.Any()).AnyTimes()
+	rt.Logger = logger
+	rt.Handler = NewDefaultRouter(&RouterConfig{})
+	release := make(chan struct{})
+	listening := make(chan struct{})
+	rt.Hooks = []Hook{{
+		Name: "warmup",
+		OnStart: func(context.Context) error {
+			close(listening)
+			<-release
+			return nil
+		},
+	}}
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+
+	// The listener is bound before start hooks run but the runtime is not
+	// ready until they complete.
+	<-listening
+	require.Eventually(t, func() bool {
+		return rt.Addr() != nil
+	}, time.Second, 5*time.Millisecond)
+	addr := rt.Addr().String()
+	code, report := getReadiness(t, addr)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, readinessStarting, report.Reason)
+
+	close(release)
+	<-rt.Ready()
+	code, report = getReadiness(t, addr)
+	require.Equal(t, http.StatusOK, code)
+	require.Empty(t, report.Reason)
+
+	rt.SetNotReady("rebuilding cache")
+	code, report = getReadiness(t, addr)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "rebuilding cache", report.Reason)
+	rt.SetReady()
+	code, _ = getReadiness(t, addr)
+	require.Equal(t, http.StatusOK, code)
+
+	// Readiness fails as soon as the exit signal arrives while requests
+	// are still served during the pre-drain delay.
+	rt.Exit <- nil
+	require.Eventually(t, func() bool {
+		code, report = getReadiness(t, addr)
+		return code == http.StatusServiceUnavailable
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, "draining", report.Reason)
+	require.Nil(t, <-done)
+}
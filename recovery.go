@@ -0,0 +1,133 @@
+package runhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const statCounterPanic = "http.server.panic"
+
+type logPanic struct {
+	Reason  string `logevent:"reason"`
+	Stack   string `logevent:"stack"`
+	Method  string `logevent:"method"`
+	Path    string `logevent:"path"`
+	Route   string `logevent:"route"`
+	Message string `logevent:"message,default=handler-panic"`
+}
+
+// RecoveryConfig is the container for panic recovery settings.
+type RecoveryConfig struct {
+	PanicCounter   string `description:"Name of the counter metric tracking handler panics."`
+	ProblemDetails bool   `description:"Whether a panic results in an RFC 7807 application/problem+json response rather than a plain text one."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*RecoveryConfig) Name() string {
+	return "recovery"
+}
+
+// Description returns the help information for the configuration root.
+func (*RecoveryConfig) Description() string {
+	return "Handler panic recovery configuration."
+}
+
+// Recovery converts a panic in a handler into an error response. Each
+// panic is logged with its stack trace through the logger in the request
+// context and counted. The Response handler writes the error response and
+// defaults to a 500. If the handler had already started the response then
+// the connection is aborted instead. A panic with http.ErrAbortHandler is
+// not recovered so that it aborts the response as net/http intends.
+type Recovery struct {
+	Stat             Stat
+	PanicCounterName string
+	Response         http.Handler
+}
+
+// RecoveryComponent implements the settings.Component interface for panic
+// recovery.
+type RecoveryComponent struct {
+	Stat Stat
+}
+
+// WithStat returns a copy of the component that counts panics through the
+// given stat client.
+func (c *RecoveryComponent) WithStat(stat Stat) *RecoveryComponent {
+	n := *c
+	n.Stat = stat
+	return &n
+}
+
+// Settings returns a configuration with all defaults set.
+func (*RecoveryComponent) Settings() *RecoveryConfig {
+	return &RecoveryConfig{
+		PanicCounter: statCounterPanic,
+	}
+}
+
+// New produces a Recovery bound to the given configuration.
+func (c *RecoveryComponent) New(_ context.Context, conf *RecoveryConfig) (*Recovery, error) {
+	response := http.HandlerFunc(internalServerError)
+	if conf.ProblemDetails {
+		response = problemInternalServerError
+	}
+	return &Recovery{
+		Stat:             c.Stat,
+		PanicCounterName: conf.PanicCounter,
+		Response:         response,
+	}, nil
+}
+
+// Middleware wraps a handler so that its panics are recovered.
+func (rc *Recovery) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			reason := recover()
+			if reason == nil {
+				return
+			}
+			if reason == http.ErrAbortHandler {
+				panic(reason)
+			}
+			LoggerFromContext(r.Context()).Error(logPanic{
+				Reason: fmt.Sprint(reason),
+				Stack:  string(debug.Stack()),
+				Method: r.Method,
+				Path:   r.URL.Path,
+				Route:  routePattern(r),
+			})
+			rc.Stat.Count(rc.PanicCounterName, 1)
+			if ww.Status() != 0 {
+				// The status and perhaps part of the body were already
+				// sent so the only option left is to abort the response.
+				panic(http.ErrAbortHandler)
+			}
+			response := rc.Response
+			if response == nil {
+				response = http.HandlerFunc(internalServerError)
+			}
+			response.ServeHTTP(w, r)
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+func internalServerError(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func problemInternalServerError(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":   "about:blank",
+		"title":  http.StatusText(http.StatusInternalServerError),
+		"status": http.StatusInternalServerError,
+	})
+}
@@ -0,0 +1,98 @@
+package runhttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecoveryRequest(logger Logger) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	return r.WithContext(logevent.NewContext(r.Context(), logger))
+}
+
+func TestRecovery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	cmp := &RecoveryComponent{}
+	recovery, err := cmp.WithStat(stat).New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	handler := recovery.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	logger.EXPECT().Error(gomock.Any()).Do(func(e interface{}) {
+		event := e.(logPanic)
+		require.Equal(t, "boom", event.Reason)
+		require.Equal(t, "/panic", event.Path)
+		require.Contains(t, event.Stack, "TestRecovery")
+	})
+	stat.EXPECT().Count(statCounterPanic, float64(1))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRecoveryRequest(logger))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestRecoveryProblemDetails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	cmp := &RecoveryComponent{}
+	conf := cmp.Settings()
+	conf.ProblemDetails = true
+	recovery, err := cmp.WithStat(stat).New(context.Background(), conf)
+	require.Nil(t, err)
+	handler := recovery.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+
+	logger.EXPECT().Error(gomock.Any())
+	stat.EXPECT().Count(statCounterPanic, float64(1))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newRecoveryRequest(logger))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	var problem map[string]interface{}
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&problem))
+	require.Equal(t, float64(http.StatusInternalServerError), problem["status"])
+}
+
+func TestRecoveryAbort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	recovery := &Recovery{Stat: stat, PanicCounterName: statCounterPanic}
+
+	// An abort is passed through without being reported.
+	handler := recovery.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newRecoveryRequest(logger))
+	})
+
+	// A panic after the response started is reported and then aborts
+	// the response.
+	handler = recovery.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("boom")
+	}))
+	logger.EXPECT().Error(gomock.Any())
+	stat.EXPECT().Count(statCounterPanic, float64(1))
+	w := httptest.NewRecorder()
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(w, newRecoveryRequest(logger))
+	})
+	require.True(t, strings.HasPrefix(w.Body.String(), "partial"))
+}
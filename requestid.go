@@ -0,0 +1,116 @@
+package runhttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	defaultRequestIDHeader    = "X-Request-ID"
+	defaultRequestIDMaxLength = 128
+	requestIDLogField         = "request_id"
+)
+
+// RequestIDConfig is the container for request ID settings.
+type RequestIDConfig struct {
+	Header    string `description:"Name of the header from which a request ID is accepted and in which it is returned."`
+	MaxLength int    `description:"Maximum length of an accepted request ID. Longer IDs are replaced with a generated one."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*RequestIDConfig) Name() string {
+	return "requestid"
+}
+
+// Description returns the help information for the configuration root.
+func (*RequestIDConfig) Description() string {
+	return "Request ID configuration."
+}
+
+// RequestID assigns an ID to each request. An ID given in the Header of the
+// request is used when it is no longer than MaxLength and contains only
+// letters, digits, and the characters - _ . : and otherwise a random ID is
+// generated. The ID is returned in the same header of the response, set as
+// the request_id field of the logger in the request context, and available
+// to handlers through RequestIDFromContext.
+type RequestID struct {
+	Header    string
+	MaxLength int
+}
+
+// RequestIDComponent implements the settings.Component interface for
+// request IDs.
+type RequestIDComponent struct{}
+
+// Settings returns a configuration with all defaults set.
+func (*RequestIDComponent) Settings() *RequestIDConfig {
+	return &RequestIDConfig{
+		Header:    defaultRequestIDHeader,
+		MaxLength: defaultRequestIDMaxLength,
+	}
+}
+
+// New produces a RequestID bound to the given configuration.
+func (*RequestIDComponent) New(_ context.Context, conf *RequestIDConfig) (*RequestID, error) {
+	if conf.Header == "" {
+		return nil, errors.New("requestid header must not be empty")
+	}
+	if conf.MaxLength < 1 {
+		return nil, fmt.Errorf("requestid maxlength must be positive but was %d", conf.MaxLength)
+	}
+	return &RequestID{
+		Header:    http.CanonicalHeaderKey(conf.Header),
+		MaxLength: conf.MaxLength,
+	}, nil
+}
+
+// Middleware wraps a handler so that each of its requests has an ID.
+func (rid *RequestID) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(rid.Header)
+		if !rid.valid(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(rid.Header, id)
+		LoggerFromContext(r.Context()).SetField(requestIDLogField, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// valid reports whether an inbound ID may be used.
+func (rid *RequestID) valid(id string) bool {
+	if id == "" || len(id) > rid.MaxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128 bit ID encoded as hex.
+func newRequestID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request being served or an
+// empty string if the request has no ID. Outbound calls made on behalf of
+// the request should pass it on so that the logs of each service can be
+// correlated.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
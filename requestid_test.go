@@ -0,0 +1,86 @@
+package runhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	cmp := &RequestIDComponent{}
+	conf := cmp.Settings()
+	conf.Header = "x-correlation-id"
+	conf.MaxLength = 16
+	requestID, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	var seen string
+	handler := requestID.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+	serve := func(inbound string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if inbound != "" {
+			r.Header.Set("X-Correlation-ID", inbound)
+		}
+		r = r.WithContext(logevent.NewContext(r.Context(), logger))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		require.Equal(t, seen, w.Header().Get("X-Correlation-ID"))
+		return seen
+	}
+
+	tc := []struct {
+		name     string
+		inbound  string
+		accepted bool
+	}{
+		{name: "valid", inbound: "abc-123_x.y:z", accepted: true},
+		{name: "missing", inbound: ""},
+		{name: "too long", inbound: strings.Repeat("a", 17)},
+		{name: "invalid characters", inbound: "abc 123"},
+		{name: "non-ascii", inbound: "abcé"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			var field interface{}
+			logger.EXPECT().SetField(requestIDLogField, gomock.Any()).Do(func(_ string, v interface{}) {
+				field = v
+			})
+			id := serve(tt.inbound)
+			require.NotEmpty(t, id)
+			require.Equal(t, id, field)
+			if tt.accepted {
+				require.Equal(t, tt.inbound, id)
+			} else {
+				require.NotEqual(t, tt.inbound, id)
+				require.Len(t, id, 32)
+			}
+		})
+	}
+}
+
+func TestRequestIDComponentInvalid(t *testing.T) {
+	cmp := &RequestIDComponent{}
+	conf := cmp.Settings()
+	conf.Header = ""
+	_, err := cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+
+	conf = cmp.Settings()
+	conf.MaxLength = 0
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestRequestIDFromContextEmpty(t *testing.T) {
+	require.Equal(t, "", RequestIDFromContext(context.Background()))
+}
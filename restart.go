@@ -0,0 +1,187 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+type logRestartStarted struct {
+	Message string `logevent:"message,default=restart-started"`
+}
+
+type logRestartComplete struct {
+	Message string `logevent:"message,default=restart-complete"`
+}
+
+// RestartConfig is the container for in-process restart settings.
+type RestartConfig struct {
+	Signals []int `description:"Which OS signals replace the server with a new one without closing the listener, such as 1 for SIGHUP. Empty disables restarts."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*RestartConfig) Name() string {
+	return "restart"
+}
+
+// Description returns the help information for the configuration root.
+func (*RestartConfig) Description() string {
+	return "In-process server restart configuration."
+}
+
+// RestartComponent implements the settings.Component interface for
+// in-process restarts.
+type RestartComponent struct{}
+
+// Settings returns a configuration with all defaults set.
+func (*RestartComponent) Settings() *RestartConfig {
+	return &RestartConfig{}
+}
+
+// New produces a RestartSignal that emits on each of the configured OS
+// signals. The result is nil when no signals are configured.
+func (*RestartComponent) New(_ context.Context, conf *RestartConfig) (RestartSignal, error) {
+	if len(conf.Signals) < 1 {
+		return nil, nil
+	}
+	sigs := make([]os.Signal, 0, len(conf.Signals))
+	for _, sig := range conf.Signals {
+		sigs = append(sigs, syscall.Signal(sig))
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	restart := make(RestartSignal, 1)
+	go func() {
+		for range c {
+			// Signals that arrive while a restart is already pending
+			// are merged into it.
+			select {
+			case restart <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return restart, nil
+}
+
+// restart replaces each server with a new one from its ServerFn. A new
+// server begins accepting connections before the one it replaces is
+// drained so that no connection is refused. The replaced servers are
+// drained in the background so that signals continue to be handled and
+// shutdown waits for them to finish.
+func (r *Runtime) restart(ctx context.Context, serveErr chan error) {
+	r.Logger.Info(logRestartStarted{})
+	policy := r.shutdownPolicy()
+	for _, inst := range r.instances {
+		previous, cancelPrevious := inst.server, inst.cancel
+		inst.server, inst.cancel = r.newServer(ctx, inst)
+		r.serve(inst, serveErr)
+		r.replaced.Add(1)
+		go func() {
+			defer r.replaced.Done()
+			// A failure to drain is logged and does not affect the new
+			// server.
+			_ = r.drain(previous, cancelPrevious, policy.RestartDrainTimerName)
+		}()
+	}
+	r.Logger.Info(logRestartComplete{})
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// sharedListener allows a series of servers to accept connections from one
+// listener. Closing a server closes only its view of the listener so the
+// socket remains open for the server that replaces it.
+type sharedListener struct {
+	net.Listener
+	accepted chan acceptResult
+	closed   chan struct{}
+	failed   chan struct{}
+	err      error
+	once     sync.Once
+}
+
+func newSharedListener(l net.Listener) *sharedListener {
+	s := &sharedListener{
+		Listener: l,
+		accepted: make(chan acceptResult),
+		closed:   make(chan struct{}),
+		failed:   make(chan struct{}),
+	}
+	go s.acceptLoop()
+	return s
+}
+
+func (s *sharedListener) acceptLoop() {
+	for {
+		conn, err := s.Listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			// Every view, rather than only the next, must report that
+			// the listener is gone.
+			s.err = err
+			close(s.failed)
+			return
+		}
+		select {
+		case s.accepted <- acceptResult{conn: conn, err: err}:
+		case <-s.closed:
+			if conn != nil {
+				_ = conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// View returns a listener that accepts connections from the shared
+// listener until it is closed.
+func (s *sharedListener) View() net.Listener {
+	return &listenerView{shared: s, closed: make(chan struct{})}
+}
+
+// Close the underlying listener and stop accepting connections.
+func (s *sharedListener) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.closed)
+		err = s.Listener.Close()
+	})
+	return err
+}
+
+type listenerView struct {
+	shared *sharedListener
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (v *listenerView) Accept() (net.Conn, error) {
+	select {
+	case result := <-v.shared.accepted:
+		return result.conn, result.err
+	case <-v.closed:
+		return nil, net.ErrClosed
+	case <-v.shared.closed:
+		return nil, net.ErrClosed
+	case <-v.shared.failed:
+		return nil, v.shared.err
+	}
+}
+
+func (v *listenerView) Close() error {
+	v.once.Do(func() {
+		close(v.closed)
+	})
+	return nil
+}
+
+func (v *listenerView) Addr() net.Addr {
+	return v.shared.Addr()
+}
@@ -0,0 +1,157 @@
+package runhttp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestartComponentDisabled(t *testing.T) {
+	cmp := &RestartComponent{}
+	restart, err := cmp.New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	require.Nil(t, restart)
+}
+
+// newRestartLogger returns a logger that may be used while the replaced
+// server drains. The logevent logger changes package settings each time
+// it is copied for a request, which races with logging from the restart.
+func newRestartLogger(t *testing.T) Logger {
+	ctrl := gomock.NewController(t)
+	logger := NewMockLogger(ctrl)
+	logger.EXPECT().Copy().Return(logger).AnyTimes()
+	logger.EXPECT().SetField(gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Info(gomock.Any()).AnyTimes()
+	logger.EXPECT().Warn(gomock.Any()).AnyTimes()
+	return logger
+}
+
+func TestRuntimeRestart(t *testing.T) {
+	rt := newTestRuntime(t)
+	rt.Logger = newRestartLogger(t)
+	rt.Restart = make(RestartSignal)
+	var servers atomic.Int32
+	serverFn := rt.Server
+	rt.Server = func() *http.Server {
+		servers.Add(1)
+		return serverFn()
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	rt.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		_, _ = w.Write([]byte("done"))
+	})
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(path string) (string, error) {
+		resp, err := client.Get("http://" + rt.Addr().String() + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+	<-rt.Ready()
+	addr := rt.Addr()
+
+	slow := make(chan string, 1)
+	go func() {
+		body, _ := get("/slow")
+		slow <- body
+	}()
+	<-started
+	rt.Restart <- struct{}{}
+
+	// The replacement server handles new requests while the original
+	// drains the request that was in flight during the restart.
+	require.Eventually(t, func() bool {
+		return servers.Load() == 2
+	}, time.Second, 10*time.Millisecond)
+	body, err := get("/")
+	require.Nil(t, err)
+	require.Equal(t, "done", body)
+	close(release)
+	require.Equal(t, "done", <-slow)
+	require.Equal(t, addr, rt.Addr())
+
+	rt.Exit <- nil
+	require.Nil(t, <-done)
+	// The listener is closed once the runtime exits.
+	_, err = net.Dial("tcp", addr.String())
+	require.NotNil(t, err)
+}
+
+func TestRuntimeRunRepeatedly(t *testing.T) {
+	rt := newTestRuntime(t)
+	for run := 0; run < 3; run = run + 1 {
+		done := make(chan error, 1)
+		go func() {
+			done <- rt.Run()
+		}()
+		<-rt.Ready()
+		resp, err := http.Get("http://" + rt.Addr().String())
+		require.Nil(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		rt.Exit <- nil
+		require.Nil(t, <-done)
+	}
+}
+
+func TestRuntimeRestartDrainInBackground(t *testing.T) {
+	rt := newTestRuntime(t)
+	rt.Logger = newRestartLogger(t)
+	rt.Restart = make(RestartSignal)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	rt.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+	<-rt.Ready()
+	slow := make(chan error, 1)
+	go func() {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get("http://" + rt.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		slow <- err
+	}()
+	<-started
+	rt.Restart <- struct{}{}
+
+	// The exit signal is handled while the replaced server is still
+	// draining the request that was in flight during the restart.
+	rt.Exit <- nil
+	require.Eventually(t, rt.draining.Load, time.Second, 10*time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("the runtime exited before the replaced server drained")
+	default:
+	}
+	close(release)
+	require.Nil(t, <-slow)
+	require.Nil(t, <-done)
+}
@@ -0,0 +1,415 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// RetryErrorTimeout is the class of transport errors caused by a
+	// timeout other than the deadline of the request itself.
+	RetryErrorTimeout = "TIMEOUT"
+	// RetryErrorConnection is the class of transport errors that occur
+	// before a connection is established, such as a refused connection or
+	// a failed DNS lookup. The request was not sent.
+	RetryErrorConnection = "CONNECTION"
+	// RetryErrorReset is the class of transport errors caused by a
+	// connection that was closed or reset before the response arrived.
+	RetryErrorReset = "RESET"
+
+	statCounterClientRetry = "http.client.retry"
+	statCounterClientHedge = "http.client.hedge"
+
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 2 * time.Second
+	defaultRetryMultiplier     = 2.0
+	defaultRetryJitter         = 0.2
+
+	// maxDiscardedBody is the most of the body of a retried response that
+	// is read so that its connection can be reused. A connection with more
+	// left to read is closed instead.
+	maxDiscardedBody = 64 << 10
+)
+
+var (
+	defaultRetryStatusCodes = []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	defaultRetryErrors  = []string{RetryErrorTimeout, RetryErrorConnection, RetryErrorReset}
+	defaultRetryMethods = []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodOptions,
+		http.MethodTrace,
+		http.MethodPut,
+		http.MethodDelete,
+	}
+)
+
+// RetryConfig is the container for outbound retry settings.
+type RetryConfig struct {
+	MaxAttempts       int           `description:"Maximum number of attempts of each request, including the first. One disables retries."`
+	InitialBackoff    time.Duration `description:"Delay before the first retry."`
+	MaxBackoff        time.Duration `description:"Maximum delay before a retry."`
+	Multiplier        float64       `description:"Factor by which the delay grows with each retry."`
+	Jitter            float64       `description:"Fraction of each delay, from 0 to 1, that is randomly removed so that clients do not retry in step."`
+	StatusCodes       []int         `description:"Response statuses that are retried."`
+	Errors            []string      `description:"Classes of transport errors that are retried. Any of TIMEOUT, CONNECTION, RESET."`
+	Methods           []string      `description:"Request methods that are retried or hedged. Only methods that are safe to repeat should be listed."`
+	RespectRetryAfter bool          `description:"Whether a Retry-After response header extends the delay before the next attempt. A delay beyond the maximum backoff ends the retries."`
+	HedgeDelay        time.Duration `description:"Delay after which a second copy of an attempt is sent if the first has not responded. Zero disables hedging."`
+	RetryCounter      string        `description:"Name of the counter metric tracking retried outbound requests."`
+	HedgeCounter      string        `description:"Name of the counter metric tracking hedged outbound requests."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*RetryConfig) Name() string {
+	return "retry"
+}
+
+// Description returns the help information for the configuration root.
+func (*RetryConfig) Description() string {
+	return "Outbound request retry configuration."
+}
+
+// newRetryConfig returns the retry settings with all defaults set.
+func newRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts:       defaultRetryMaxAttempts,
+		InitialBackoff:    defaultRetryInitialBackoff,
+		MaxBackoff:        defaultRetryMaxBackoff,
+		Multiplier:        defaultRetryMultiplier,
+		Jitter:            defaultRetryJitter,
+		StatusCodes:       append([]int(nil), defaultRetryStatusCodes...),
+		Errors:            append([]string(nil), defaultRetryErrors...),
+		Methods:           append([]string(nil), defaultRetryMethods...),
+		RespectRetryAfter: true,
+		RetryCounter:      statCounterClientRetry,
+		HedgeCounter:      statCounterClientHedge,
+	}
+}
+
+// newRetryTransport creates a RetryTransport from the configuration.
+func newRetryTransport(base http.RoundTripper, conf *RetryConfig) (*RetryTransport, error) {
+	switch {
+	case conf.MaxAttempts < 1:
+		return nil, fmt.Errorf("client retry maxattempts must be positive but was %d", conf.MaxAttempts)
+	case conf.InitialBackoff < 0:
+		return nil, fmt.Errorf("client retry initialbackoff must not be negative but was %s", conf.InitialBackoff)
+	case conf.MaxBackoff < conf.InitialBackoff:
+		return nil, fmt.Errorf("client retry maxbackoff %s must not be less than initialbackoff %s", conf.MaxBackoff, conf.InitialBackoff)
+	case conf.Multiplier < 1:
+		return nil, fmt.Errorf("client retry multiplier must be at least 1 but was %g", conf.Multiplier)
+	case conf.Jitter < 0 || conf.Jitter > 1:
+		return nil, fmt.Errorf("client retry jitter must be between 0 and 1 but was %g", conf.Jitter)
+	case conf.HedgeDelay < 0:
+		return nil, fmt.Errorf("client retry hedgedelay must not be negative but was %s", conf.HedgeDelay)
+	}
+	transport := &RetryTransport{
+		Base:              base,
+		MaxAttempts:       conf.MaxAttempts,
+		InitialBackoff:    conf.InitialBackoff,
+		MaxBackoff:        conf.MaxBackoff,
+		Multiplier:        conf.Multiplier,
+		Jitter:            conf.Jitter,
+		StatusCodes:       make(map[int]bool, len(conf.StatusCodes)),
+		Errors:            make(map[string]bool, len(conf.Errors)),
+		Methods:           make(map[string]bool, len(conf.Methods)),
+		RespectRetryAfter: conf.RespectRetryAfter,
+		HedgeDelay:        conf.HedgeDelay,
+		RetryCounterName:  conf.RetryCounter,
+		HedgeCounterName:  conf.HedgeCounter,
+	}
+	for _, status := range conf.StatusCodes {
+		transport.StatusCodes[status] = true
+	}
+	for _, class := range conf.Errors {
+		class = strings.ToUpper(class)
+		switch class {
+		case RetryErrorTimeout, RetryErrorConnection, RetryErrorReset:
+		default:
+			return nil, fmt.Errorf("unknown client retry error class %s", class)
+		}
+		transport.Errors[class] = true
+	}
+	for _, method := range conf.Methods {
+		transport.Methods[strings.ToUpper(method)] = true
+	}
+	return transport, nil
+}
+
+// RetryTransport repeats requests that fail with one of the StatusCodes or
+// one of the classes of Errors, up to MaxAttempts in total. Only requests
+// with one of the Methods and a body that can be replayed through GetBody
+// are repeated.
+//
+// The delay before each retry starts at InitialBackoff and grows by the
+// Multiplier up to the MaxBackoff, less a random fraction of up to Jitter.
+// If RespectRetryAfter is set then a Retry-After header in the response
+// extends the delay, or ends the retries when it asks for more than the
+// MaxBackoff. Retries also end when the next attempt could not start
+// before the deadline of the request context, so that the deadline of an
+// inbound request bounds the outbound calls made on its behalf.
+//
+// If a HedgeDelay is set then a second copy of an attempt is sent when the
+// first has not responded within the delay. The first of the two to
+// succeed is used and the other is cancelled. A failure is only returned
+// once both copies have failed.
+//
+// Each retry and each hedge is counted through the stat client in the
+// request context, tagged with the host.
+type RetryTransport struct {
+	Base              http.RoundTripper
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	Multiplier        float64
+	Jitter            float64
+	StatusCodes       map[int]bool
+	Errors            map[string]bool
+	Methods           map[string]bool
+	RespectRetryAfter bool
+	HedgeDelay        time.Duration
+	RetryCounterName  string
+	HedgeCounterName  string
+}
+
+// RoundTrip sends the request and any retries.
+func (t *RetryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !t.Methods[r.Method] || !replayable(r) {
+		return t.base().RoundTrip(r)
+	}
+	ctx := r.Context()
+	for attempt := 1; ; attempt++ {
+		req := r
+		if attempt > 1 {
+			var err error
+			if req, err = replay(ctx, r); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := t.attempt(req)
+		if attempt >= t.MaxAttempts || !t.retryable(ctx, resp, err) {
+			return resp, err
+		}
+		delay, ok := t.delay(attempt, resp)
+		if deadline, hasDeadline := ctx.Deadline(); ok && hasDeadline && time.Until(deadline) < delay {
+			ok = false
+		}
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDiscardedBody))
+			resp.Body.Close()
+		}
+		StatFromContext(ctx).Count(t.RetryCounterName, 1, "host:"+r.URL.Host)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryable reports whether the outcome of an attempt should be retried.
+func (t *RetryTransport) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return t.Errors[retryErrorClass(err)]
+	}
+	return t.StatusCodes[resp.StatusCode]
+}
+
+// delay returns the wait before the next attempt. It is not ok to retry
+// when the response asks for a longer wait than the MaxBackoff.
+func (t *RetryTransport) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	backoff := float64(t.InitialBackoff) * math.Pow(t.Multiplier, float64(attempt-1))
+	if backoff > float64(t.MaxBackoff) {
+		backoff = float64(t.MaxBackoff)
+	}
+	delay := time.Duration(backoff * (1 - t.Jitter*rand.Float64()))
+	if !t.RespectRetryAfter || resp == nil {
+		return delay, true
+	}
+	after, ok := retryAfter(resp.Header.Get("Retry-After"))
+	if !ok {
+		return delay, true
+	}
+	if after > t.MaxBackoff {
+		return 0, false
+	}
+	return max(delay, after), true
+}
+
+// hedgeResult is the outcome of one copy of an attempt.
+type hedgeResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// attempt sends the request once or, when hedging, up to twice.
+func (t *RetryTransport) attempt(r *http.Request) (*http.Response, error) {
+	if t.HedgeDelay <= 0 {
+		return t.base().RoundTrip(r)
+	}
+	ctx := r.Context()
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func(req *http.Request) {
+		reqCtx, cancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := t.base().RoundTrip(req.WithContext(reqCtx))
+			results <- hedgeResult{index: index, resp: resp, err: err}
+		}()
+	}
+	send(r)
+	timer := time.NewTimer(t.HedgeDelay)
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			hedge, err := replay(ctx, r)
+			if err != nil {
+				continue
+			}
+			StatFromContext(ctx).Count(t.HedgeCounterName, 1, "host:"+r.URL.Host)
+			send(hedge)
+			pending++
+		case result := <-results:
+			pending--
+			// A failed copy is only used once the other has failed too
+			// so that it cannot cancel a copy that would succeed.
+			if pending > 0 && (result.err != nil || t.retryable(ctx, result.resp, result.err)) {
+				discardHedge(result, cancels[result.index])
+				continue
+			}
+			if pending > 0 {
+				// The other copy is cancelled now rather than once it
+				// responds so that a slow attempt does not linger.
+				other := cancels[1-result.index]
+				other()
+				go func() {
+					discardHedge(<-results, other)
+				}()
+			}
+			cancel := cancels[result.index]
+			if result.err != nil {
+				cancel()
+				return nil, result.err
+			}
+			result.resp.Body = &cancelBody{ReadCloser: result.resp.Body, cancel: cancel}
+			return result.resp, nil
+		}
+	}
+}
+
+// discardHedge releases the copy of an attempt that is not used.
+func discardHedge(result hedgeResult, cancel context.CancelFunc) {
+	cancel()
+	if result.resp != nil {
+		result.resp.Body.Close()
+	}
+}
+
+// cancelBody releases the context of a hedged attempt once its response
+// body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (t *RetryTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// replayable reports whether the body of a request can be sent again.
+func replayable(r *http.Request) bool {
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
+
+// replay copies a request with a fresh body for another attempt.
+func replay(ctx context.Context, r *http.Request) (*http.Request, error) {
+	req := r.Clone(ctx)
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return req, nil
+}
+
+// retryErrorClass returns the class of a transport error or an empty
+// string if the error is not one of the known classes.
+func retryErrorClass(err error) string {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.As(err, &dnsErr),
+		errors.As(err, &opErr) && opErr.Op == "dial":
+		return RetryErrorConnection
+	case errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return RetryErrorReset
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return RetryErrorTimeout
+	}
+	return ""
+}
+
+// retryAfter parses a Retry-After header given as either seconds or an
+// HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(time.Until(at), 0), true
+}
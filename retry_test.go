@@ -0,0 +1,403 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRetryTransport(t *testing.T, modify func(*RetryConfig)) *RetryTransport {
+	t.Helper()
+	conf := newRetryConfig()
+	conf.InitialBackoff = time.Millisecond
+	conf.MaxBackoff = 10 * time.Millisecond
+	if modify != nil {
+		modify(conf)
+	}
+	transport, err := newRetryTransport(http.DefaultTransport, conf)
+	require.Nil(t, err)
+	return transport
+}
+
+// flakyServer fails with the given status until it has been called the
+// given number of times.
+func flakyServer(failures int32, status int, bodies *[]string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bodies != nil {
+			body, _ := io.ReadAll(r.Body)
+			*bodies = append(*bodies, string(body))
+		}
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	return ts, &calls
+}
+
+func TestRetryTransport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	var bodies []string
+	ts, calls := flakyServer(2, http.StatusServiceUnavailable, &bodies)
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	stat.EXPECT().Count(statCounterClientRetry, float64(1), "host:"+host).Times(2)
+	ctx := xstats.NewContext(context.Background(), stat)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, ts.URL, strings.NewReader("payload"))
+	require.Nil(t, err)
+	resp, err := newTestRetryTransport(t, nil).RoundTrip(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(3), calls.Load())
+	require.Equal(t, []string{"payload", "payload", "payload"}, bodies)
+}
+
+func TestRetryTransportMaxAttempts(t *testing.T) {
+	ts, calls := flakyServer(5, http.StatusBadGateway, nil)
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodGet, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	resp, err := newTestRetryTransport(t, func(c *RetryConfig) { c.MaxAttempts = 2 }).RoundTrip(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestRetryTransportNotRetried(t *testing.T) {
+	tc := []struct {
+		name   string
+		status int
+		req    func(url string) *http.Request
+	}{
+		{
+			name:   "non-idempotent method",
+			status: http.StatusServiceUnavailable,
+			req: func(url string) *http.Request {
+				req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader("payload"))
+				return req
+			},
+		},
+		{
+			name:   "body cannot be replayed",
+			status: http.StatusServiceUnavailable,
+			req: func(url string) *http.Request {
+				req, _ := http.NewRequest(http.MethodPut, url, io.NopCloser(strings.NewReader("payload")))
+				return req
+			},
+		},
+		{
+			name:   "status not retryable",
+			status: http.StatusInternalServerError,
+			req: func(url string) *http.Request {
+				req, _ := http.NewRequest(http.MethodGet, url, http.NoBody)
+				return req
+			},
+		},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, calls := flakyServer(1, tt.status, nil)
+			defer ts.Close()
+			resp, err := newTestRetryTransport(t, nil).RoundTrip(tt.req(ts.URL))
+			require.Nil(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.status, resp.StatusCode)
+			require.Equal(t, int32(1), calls.Load())
+		})
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("slow down"))
+	}))
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodGet, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	resp, err := newTestRetryTransport(t, nil).RoundTrip(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, int32(1), calls.Load())
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "slow down", string(body))
+}
+
+func TestRetryTransportDelay(t *testing.T) {
+	transport := newTestRetryTransport(t, func(c *RetryConfig) {
+		c.InitialBackoff = 100 * time.Millisecond
+		c.MaxBackoff = 5 * time.Second
+		c.Jitter = 0
+	})
+	withRetryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+	tc := []struct {
+		name    string
+		attempt int
+		resp    *http.Response
+		delay   time.Duration
+		ok      bool
+	}{
+		{name: "first", attempt: 1, delay: 100 * time.Millisecond, ok: true},
+		{name: "exponential", attempt: 3, delay: 400 * time.Millisecond, ok: true},
+		{name: "capped", attempt: 10, delay: 5 * time.Second, ok: true},
+		{name: "retry after seconds", attempt: 1, resp: withRetryAfter("2"), delay: 2 * time.Second, ok: true},
+		{name: "retry after shorter than backoff", attempt: 3, resp: withRetryAfter("0"), delay: 400 * time.Millisecond, ok: true},
+		{name: "retry after past date", attempt: 1, resp: withRetryAfter("Wed, 21 Oct 2015 07:28:00 GMT"), delay: 100 * time.Millisecond, ok: true},
+		{name: "retry after invalid", attempt: 1, resp: withRetryAfter("soon"), delay: 100 * time.Millisecond, ok: true},
+		{name: "retry after too long", attempt: 1, resp: withRetryAfter("6")},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := transport.delay(tt.attempt, tt.resp)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.delay, delay)
+		})
+	}
+
+	transport.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay, _ := transport.delay(1, nil)
+		require.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		require.LessOrEqual(t, delay, 100*time.Millisecond)
+	}
+}
+
+func TestRetryTransportDeadline(t *testing.T) {
+	ts, calls := flakyServer(5, http.StatusServiceUnavailable, nil)
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	transport := newTestRetryTransport(t, func(c *RetryConfig) {
+		c.InitialBackoff = time.Second
+		c.MaxBackoff = time.Second
+		c.Jitter = 0
+	})
+	resp, err := transport.RoundTrip(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetryTransportConnectionError(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	var attempts atomic.Int32
+	transport := newTestRetryTransport(t, nil)
+	transport.Base = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		attempts.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	req, err := http.NewRequest(http.MethodGet, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	_, err = transport.RoundTrip(req)
+	require.True(t, errors.Is(err, syscall.ECONNREFUSED))
+	require.Equal(t, int32(3), attempts.Load())
+}
+
+// endlessBody is a response body that never ends and counts the bytes read
+// from it.
+type endlessBody struct {
+	read   atomic.Int64
+	closed atomic.Bool
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	b.read.Add(int64(len(p)))
+	return len(p), nil
+}
+
+func (b *endlessBody) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func TestRetryTransportDiscardLimit(t *testing.T) {
+	body := &endlessBody{}
+	var attempts atomic.Int32
+	transport := newTestRetryTransport(t, nil)
+	transport.Base = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if attempts.Add(1) == 1 {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: body}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+	})
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", http.NoBody)
+	require.Nil(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(2), attempts.Load())
+	require.LessOrEqual(t, body.read.Load(), int64(maxDiscardedBody))
+	require.True(t, body.closed.Load())
+}
+
+func TestRetryTransportHedgeFailure(t *testing.T) {
+	var calls atomic.Int32
+	transport := newTestRetryTransport(t, func(c *RetryConfig) {
+		c.MaxAttempts = 1
+		c.HedgeDelay = 10 * time.Millisecond
+	})
+	transport.Base = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if calls.Add(1) == 1 {
+			time.Sleep(50 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+		}
+		return nil, errors.New("unknown")
+	})
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", http.NoBody)
+	require.Nil(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(2), calls.Load())
+
+	// The error is returned once both copies have failed.
+	calls.Store(0)
+	transport.Base = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if calls.Add(1) == 1 {
+			time.Sleep(50 * time.Millisecond)
+			return nil, errors.New("first")
+		}
+		return nil, errors.New("second")
+	})
+	_, err = transport.RoundTrip(req)
+	require.EqualError(t, err, "first")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRetryErrorClass(t *testing.T) {
+	tc := []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{name: "refused", err: fmt.Errorf("wrapped: %w", &net.OpError{Op: "read", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), class: RetryErrorConnection},
+		{name: "dial", err: &net.OpError{Op: "dial", Err: errors.New("no route")}, class: RetryErrorConnection},
+		{name: "dns", err: &net.DNSError{Err: "no such host", IsNotFound: true}, class: RetryErrorConnection},
+		{name: "reset", err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, class: RetryErrorReset},
+		{name: "eof", err: io.EOF, class: RetryErrorReset},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, class: RetryErrorReset},
+		{name: "deadline", err: context.DeadlineExceeded, class: RetryErrorTimeout},
+		{name: "net timeout", err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, class: RetryErrorTimeout},
+		{name: "other", err: errors.New("unknown"), class: ""},
+		{name: "canceled", err: context.Canceled, class: ""},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.class, retryErrorClass(tt.err))
+		})
+	}
+}
+
+func TestRetryTransportHedge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stat := NewMockStat(ctrl)
+	var calls atomic.Int32
+	cancelled := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		_, _ = w.Write([]byte("hedged"))
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	stat.EXPECT().Count(statCounterClientHedge, float64(1), "host:"+host)
+	ctx := xstats.NewContext(context.Background(), stat)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	transport := newTestRetryTransport(t, func(c *RetryConfig) { c.HedgeDelay = 20 * time.Millisecond })
+	resp, err := transport.RoundTrip(req)
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Nil(t, resp.Body.Close())
+	require.Equal(t, "hedged", string(body))
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the slower attempt was not cancelled")
+	}
+}
+
+func TestRetryTransportHedgeNotNeeded(t *testing.T) {
+	ts, calls := flakyServer(0, http.StatusOK, nil)
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodGet, ts.URL, http.NoBody)
+	require.Nil(t, err)
+	transport := newTestRetryTransport(t, func(c *RetryConfig) { c.HedgeDelay = time.Second })
+	resp, err := transport.RoundTrip(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetryConfigInvalid(t *testing.T) {
+	tc := []struct {
+		name   string
+		modify func(*RetryConfig)
+	}{
+		{name: "zero attempts", modify: func(c *RetryConfig) { c.MaxAttempts = 0 }},
+		{name: "negative backoff", modify: func(c *RetryConfig) { c.InitialBackoff = -time.Second }},
+		{name: "max below initial", modify: func(c *RetryConfig) { c.MaxBackoff = c.InitialBackoff / 2 }},
+		{name: "shrinking multiplier", modify: func(c *RetryConfig) { c.Multiplier = 0.5 }},
+		{name: "jitter above one", modify: func(c *RetryConfig) { c.Jitter = 1.5 }},
+		{name: "negative hedge delay", modify: func(c *RetryConfig) { c.HedgeDelay = -time.Second }},
+		{name: "unknown error class", modify: func(c *RetryConfig) { c.Errors = []string{"SOMETIMES"} }},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			cmp := &ClientComponent{}
+			conf := cmp.Settings()
+			tt.modify(conf.Retry)
+			_, err := cmp.New(context.Background(), conf)
+			require.NotNil(t, err)
+		})
+	}
+}
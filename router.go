@@ -6,17 +6,24 @@ import (
 
 // RouterConfig is used as a simple default for NewDefaultRouter
 type RouterConfig struct {
+	// Health, if set, provides the checks of the health endpoints. The
+	// checks of the Runtime serving the request are used when it is not
+	// set.
+	Health *HealthRegistry
 }
 
 // NewDefaultRouter generates a mux.
 // This version returns a mux from the chi project
 // as a convenience for cases where custom middleware or additional
-// routes need to be configured.
+// routes need to be configured. The mux hosts the health endpoints
+// /healthcheck, /healthcheck/live, and /healthcheck/ready.
 func NewDefaultRouter(conf *RouterConfig) *chi.Mux {
 	router := chi.NewMux()
-	healthCheckHandler := &HealthCheckHandler{}
+	healthCheckHandler := &HealthCheckHandler{Health: conf.Health}
 
 	router.Get("/healthcheck", healthCheckHandler.Handle)
+	router.Get("/healthcheck/live", healthCheckHandler.Live)
+	router.Get("/healthcheck/ready", healthCheckHandler.Ready)
 
 	return router
 }
@@ -18,3 +18,13 @@ func TestRouterHasHealthCheck(t *testing.T) {
 	router.ServeHTTP(resp, req)
 	require.Equal(t, http.StatusOK, resp.Code)
 }
+
+func TestRouterHasLivenessAndReadiness(t *testing.T) {
+	router := NewDefaultRouter(&RouterConfig{Health: NewHealthRegistry()})
+	for _, path := range []string{"/healthcheck/live", "/healthcheck/ready"} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, http.NoBody)
+		router.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code, path)
+	}
+}
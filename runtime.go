@@ -2,8 +2,11 @@ package runhttp
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/rs/xstats"
 
@@ -18,37 +21,308 @@ import (
 // the Run method on each signal received from the output of the
 // SignalFn, and use the ServerFn to regenerate a working server on
 // subsequent Run calls.
+//
+// Any Admin server and named Servers are run alongside the main server.
+// They share the signals, hooks, and shutdown policy of the Runtime so that
+// every server starts together and is shut down together.
 type Runtime struct {
-	Logger    Logger
-	Stats     Stat
-	ConnState *connstate.ConnState
-	Expvar    *expvar.Expvar
-	Exit      signals.Signal
-	Server    *http.Server
-	Handler   http.Handler
+	Logger       Logger
+	Stats        Stat
+	ConnState    *connstate.ConnState
+	Expvar       *expvar.Expvar
+	Exit         signals.Signal
+	Restart      RestartSignal
+	Shutdown     *Shutdown
+	Upgrade      *Upgrade
+	Hooks        []Hook
+	Health       *HealthRegistry
+	RequestID    *RequestID
+	Tracer       *Tracer
+	Recovery     *Recovery
+	AccessLog    *AccessLog
+	Metrics      *Metrics
+	Client       *http.Client
+	Server       ServerFn
+	Certificates *CertificateManager
+	Handler      http.Handler
+	Admin        *HostedServer
+	Servers      map[string]*HostedServer
+
+	// Listen, if set, creates the listener for the server. A TCP listener
+	// on the address of the server is used when it is not set.
+	Listen ListenerFn
+	// BaseContext, if set, is the parent of every request context. The
+	// context given to RunContext is used when it is not set.
+	BaseContext context.Context
+
+	draining   atomic.Bool
+	readiness  readiness
+	instances  []*instance
+	replaced   sync.WaitGroup
+	background sync.Once
+	closed     sync.Once
+
+	lock  sync.Mutex
+	ready chan struct{}
+	addrs map[string]net.Addr
+}
+
+// Ready returns a channel that is closed once the server is accepting
+// connections and every start hook has completed. The channel is replaced
+// when a run ends so that it may be used to wait for the next run.
+func (r *Runtime) Ready() <-chan struct{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.readyLocked()
+}
+
+func (r *Runtime) readyLocked() chan struct{} {
+	if r.ready == nil {
+		r.ready = make(chan struct{})
+	}
+	return r.ready
+}
+
+// Addr returns the address the main server is bound to or nil if the
+// server is not running. This is the only way to learn the port chosen
+// when the configured address uses port zero.
+func (r *Runtime) Addr() net.Addr {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.addrs[mainServerName]
+}
+
+// AdminAddr returns the address the admin server is bound to or nil if the
+// admin server is not running.
+func (r *Runtime) AdminAddr() net.Addr {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.addrs[adminServerName]
+}
+
+// ServerAddr returns the address the named server from Servers is bound to
+// or nil if the server is not running.
+func (r *Runtime) ServerAddr(name string) net.Addr {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.addrs[namedServerPrefix+name]
+}
+
+// resetReady resets the readiness of the runtime for the next run.
+func (r *Runtime) resetReady() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	select {
+	case <-r.readyLocked():
+		r.ready = nil
+	default:
+	}
 }
 
-// Run the server until a signal is received.
+// listening records the bound addresses of the runtime or clears them
+// when given nil.
+func (r *Runtime) listening(addrs map[string]net.Addr) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.addrs = addrs
+}
+
+// markReady marks the runtime as ready.
+func (r *Runtime) markReady() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	close(r.readyLocked())
+}
+
+// Run the server until a signal is received. The returned error contains
+// the error, if any, emitted by the signal along with any failure of the
+// lifecycle hooks or of the server to shut down cleanly. Run may be called
+// again after it returns and each call serves a new server from the
+// ServerFn.
 func (r *Runtime) Run() error {
+	return r.RunContext(context.Background())
+}
+
+// RunContext runs the server until either a signal is received or the
+// given context is cancelled. Cancellation starts the same graceful
+// shutdown as a signal and is not itself reported as an error.
+//
+// Request contexts inherit the values of the base context but not its
+// cancellation so that in-flight requests are allowed to drain. They are
+// instead cancelled once the drain phase of shutdown ends.
+//
+// Each value received from the Restart signal replaces the server with a
+// new one from the ServerFn without closing the listener.
+func (r *Runtime) RunContext(ctx context.Context) error {
+	instances := r.hosted()
+	r.background.Do(func() {
+		go r.Expvar.Report()
+		if r.Health != nil {
+			go r.Health.Watch()
+		}
+		if r.Tracer != nil {
+			go r.Tracer.Run()
+		}
+		for _, inst := range instances {
+			if inst.hosted.ConnState != nil {
+				go inst.hosted.ConnState.Report()
+			}
+			if inst.hosted.Certificates != nil {
+				go inst.hosted.Certificates.Watch()
+			}
+		}
+	})
+	r.draining.Store(false)
+	r.readiness.starting.Store(true)
+	r.instances = instances
+	defer func() {
+		for _, inst := range instances {
+			if inst.cancel != nil {
+				inst.cancel()
+			}
+		}
+	}()
+	defer r.resetReady()
+
+	inherited, err := inheritedListeners()
+	if err != nil {
+		return err
+	}
+	serveErr := make(chan error, 1)
+	addrs := make(map[string]net.Addr, len(instances))
+	for _, inst := range instances {
+		inst.handler = r.middleware(inst)
+		inst.server, inst.cancel = r.newServer(ctx, inst)
+
+		var listener net.Listener
+		listener, err = r.listen(inst, inherited)
+		if err != nil {
+			return err
+		}
+		inst.listener = newSharedListener(listener)
+		defer inst.listener.Close()
+		addrs[inst.name] = listener.Addr()
+		r.serve(inst, serveErr)
+	}
+	r.listening(addrs)
+	defer r.listening(nil)
 
-	go r.Expvar.Report()
-	defer r.Expvar.Close()
-	go r.ConnState.Report()
-	defer r.ConnState.Close()
+	// Stop hooks must run even when shutdown was triggered by the
+	// cancellation of ctx.
+	stopCtx := context.WithoutCancel(ctx)
+	started, err := r.startHooks(ctx)
+	if err != nil {
+		err = errors.Join(err, r.shutdown(false, nil), r.stopHooks(stopCtx, started))
+		r.flushSpans(stopCtx)
+		return err
+	}
+	r.readiness.starting.Store(false)
+	r.markReady()
+	// A failed notification is not an error of the run.
+	if notifyErr := notifyUpgradeReady(); notifyErr != nil {
+		r.Logger.Error(logUpgradeFailed{Reason: notifyErr.Error()})
+	}
 
-	handler := r.Handler
+	preDrain := true
+	// Once a signal has started the shutdown, the cancellation of ctx cuts
+	// the pre-drain phase short.
+	force := ctx.Done()
+wait:
+	for {
+		select {
+		case err = <-r.Exit:
+			break wait
+		case <-ctx.Done():
+			force = nil
+			break wait
+		case err = <-serveErr:
+			// A server stopped on its own. The others are shut down
+			// without waiting for load balancers.
+			preDrain = false
+			break wait
+		case <-r.Restart:
+			r.restart(ctx, serveErr)
+		case <-r.upgradeSignal():
+			// A failed upgrade leaves this process serving. Otherwise
+			// the new process is already accepting connections on the
+			// same sockets so there is no need to wait for load
+			// balancers before draining.
+			if r.upgrade() == nil {
+				preDrain = false
+				break wait
+			}
+		}
+	}
+	err = errors.Join(err, r.shutdown(preDrain, force), r.stopHooks(stopCtx, started))
+	r.flushSpans(stopCtx)
+	return err
+}
+
+// middleware wraps the handler of a server with the middleware of the
+// runtime. Requests to the admin server are not application traffic so
+// they are not logged, measured, or traced.
+func (r *Runtime) middleware(inst *instance) http.Handler {
+	handler := inst.hosted.Handler
+	handler = closeAfterMaxRequests(handler)
+	if r.Recovery != nil {
+		handler = r.Recovery.Middleware(handler)
+	}
+	instrumented := inst.name != adminServerName
+	if r.AccessLog != nil && instrumented {
+		handler = r.AccessLog.Middleware(handler)
+	}
+	if r.Metrics != nil && instrumented {
+		handler = r.Metrics.Middleware(handler)
+	}
 	handler = xstats.NewHandler(r.Stats, nil)(handler)
+	if r.RequestID != nil && instrumented {
+		handler = r.RequestID.Middleware(handler)
+	}
+	if r.Tracer != nil && instrumented {
+		handler = r.Tracer.Middleware(handler)
+	}
 	handler = hlog.NewMiddleware(r.Logger)(handler)
-	r.Server.Handler = handler
-
-	go func() {
-		r.Exit <- r.Server.ListenAndServe()
-	}()
+	handler = withRouteContext(inst.hosted.Handler)(handler)
+	handler = withDraining(&r.draining)(handler)
+	handler = withReadiness(&r.readiness)(handler)
+	if r.Health != nil {
+		handler = withHealth(r.Health)(handler)
+	}
+	return handler
+}
 
-	err := <-r.Exit
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	_ = r.Server.Shutdown(ctx)
+// flushSpans sends the spans of the requests served before shutdown. A
+// failure is logged rather than returned because the spans are not needed
+// for a clean shutdown.
+func (r *Runtime) flushSpans(ctx context.Context) {
+	if r.Tracer == nil {
+		return
+	}
+	if err := r.Tracer.Flush(ctx); err != nil {
+		r.Logger.Error(logSpanFlushFailed{Reason: err.Error()})
+	}
+}
 
+// Close stops the background reporting that is started by the first run.
+// It should be called once the Runtime will not be run again.
+func (r *Runtime) Close() error {
+	var err error
+	r.closed.Do(func() {
+		err = r.Expvar.Close()
+		if r.Health != nil {
+			err = errors.Join(err, r.Health.Close())
+		}
+		if r.Tracer != nil {
+			err = errors.Join(err, r.Tracer.Close())
+		}
+		for _, inst := range r.hosted() {
+			if inst.hosted.ConnState != nil {
+				err = errors.Join(err, inst.hosted.ConnState.Close())
+			}
+			if inst.hosted.Certificates != nil {
+				err = errors.Join(err, inst.hosted.Certificates.Close())
+			}
+		}
+	})
 	return err
 }
@@ -0,0 +1,117 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeReadyAndAddr(t *testing.T) {
+	rt := newTestRuntime(t)
+	require.Nil(t, rt.Addr())
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+	<-rt.Ready()
+	addr := rt.Addr()
+	require.NotNil(t, addr)
+	require.NotEqual(t, 0, addr.(*net.TCPAddr).Port)
+	resp, err := http.Get("http://" + addr.String())
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	rt.Exit <- nil
+	require.Nil(t, <-done)
+	require.Nil(t, rt.Addr())
+
+}
+
+func TestRuntimeReadyAfterStartHooks(t *testing.T) {
+	rt := newTestRuntime(t)
+	rt.Hooks = []Hook{{Name: "check", OnStart: func(context.Context) error {
+		select {
+		case <-rt.Ready():
+			return errors.New("ready before start hooks completed")
+		default:
+		}
+		rt.Exit <- nil
+		return nil
+	}}}
+	require.Nil(t, rt.Run())
+}
+
+func TestRuntimeRunContextCancel(t *testing.T) {
+	rt := newTestRuntime(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	rt.Hooks = []Hook{{
+		Name: "cancel",
+		OnStart: func(context.Context) error {
+			cancel()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			// Stop hooks are not affected by the cancellation that
+			// triggered the shutdown.
+			require.Nil(t, ctx.Err())
+			close(stopped)
+			return nil
+		},
+	}}
+	require.Nil(t, rt.RunContext(ctx))
+	<-stopped
+}
+
+func TestRuntimeUpgradeNotifyFailure(t *testing.T) {
+	t.Setenv(envUpgradeReadyFD, "invalid")
+	rt := newTestRuntime(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	rt.Hooks = []Hook{{Name: "cancel", OnStart: func(context.Context) error {
+		cancel()
+		return nil
+	}}}
+	// The failed notification is logged rather than returned.
+	require.Nil(t, rt.RunContext(ctx))
+}
+
+type testContextKey struct{}
+
+func TestRuntimeBaseContext(t *testing.T) {
+	rt := newTestRuntime(t, "RUNTIME_SHUTDOWN_DRAINTIMEOUT=50ms")
+	rt.BaseContext = context.WithValue(context.Background(), testContextKey{}, "base")
+	// The handler returns after the test ends so the request must not be
+	// logged while later tests create loggers.
+	rt.AccessLog = nil
+	started := make(chan struct{})
+	cancelled := make(chan interface{}, 1)
+	rt.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		cancelled <- r.Context().Value(testContextKey{})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.RunContext(ctx)
+	}()
+	go func() {
+		<-rt.Ready()
+		resp, err := http.Get("http://" + rt.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+	// The in-flight request outlives the drain timeout and is then
+	// cancelled, retaining the values of the base context.
+	require.ErrorIs(t, <-done, context.DeadlineExceeded)
+	require.Equal(t, "base", <-cancelled)
+}
@@ -0,0 +1,122 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+
+	connstate "github.com/asecurityteam/component-connstate"
+)
+
+const (
+	mainServerName  = "httpserver"
+	adminServerName = "admin"
+	// namedServerPrefix is prepended to the names of the servers in
+	// Runtime.Servers so that they never collide with the main or admin
+	// server.
+	namedServerPrefix = "servers."
+)
+
+// HostedServer is a server run by a Runtime in addition to its main
+// server. It shares the signals, lifecycle hooks, and shutdown policy of
+// the Runtime and is started and stopped alongside the main server.
+type HostedServer struct {
+	Server       ServerFn
+	Listen       ListenerFn
+	Handler      http.Handler
+	Certificates *CertificateManager
+	ConnState    *connstate.ConnState
+}
+
+// instance is the state of a hosted server during a run.
+type instance struct {
+	name     string
+	hosted   *HostedServer
+	handler  http.Handler
+	listener *sharedListener
+	server   *http.Server
+	cancel   context.CancelFunc
+}
+
+// hosted returns every server of the runtime with the main server first,
+// followed by the admin server and then the named servers sorted by name.
+func (r *Runtime) hosted() []*instance {
+	instances := []*instance{{
+		name: mainServerName,
+		hosted: &HostedServer{
+			Server:       r.Server,
+			Listen:       r.Listen,
+			Handler:      r.Handler,
+			Certificates: r.Certificates,
+			ConnState:    r.ConnState,
+		},
+	}}
+	if r.Admin != nil {
+		instances = append(instances, &instance{name: adminServerName, hosted: r.Admin})
+	}
+	names := make([]string, 0, len(r.Servers))
+	for name := range r.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		instances = append(instances, &instance{name: namedServerPrefix + name, hosted: r.Servers[name]})
+	}
+	return instances
+}
+
+// newServer creates a server from the ServerFn of the instance. Any
+// previous server is replaced and the returned function cancels the
+// contexts of its requests.
+func (r *Runtime) newServer(ctx context.Context, inst *instance) (*http.Server, context.CancelFunc) {
+	base := r.BaseContext
+	if base == nil {
+		base = ctx
+	}
+	base, cancel := context.WithCancel(context.WithoutCancel(base))
+	server := inst.hosted.Server()
+	server.Handler = inst.handler
+	server.BaseContext = func(net.Listener) context.Context {
+		return base
+	}
+	return server, cancel
+}
+
+// listen creates the listener of an instance. A listener inherited
+// through an upgrade takes precedence over the configured one.
+func (r *Runtime) listen(inst *instance, inherited map[string]int) (net.Listener, error) {
+	if fd, ok := inherited[inst.name]; ok {
+		return listenFD(fd, inst.name)
+	}
+	if inst.hosted.Listen != nil {
+		return inst.hosted.Listen()
+	}
+	return net.Listen("tcp", inst.server.Addr)
+}
+
+// serve runs the current server of the instance in the background. An
+// error that stops the server, other than a shutdown requested by the
+// runtime, is sent to serveErr if no other error is waiting.
+func (r *Runtime) serve(inst *instance, serveErr chan error) {
+	server := inst.server
+	listener := inst.listener.View()
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			// The certificates are already loaded into the TLSConfig so
+			// no files are given here.
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			return
+		}
+		select {
+		case serveErr <- err:
+		default:
+		}
+	}()
+}
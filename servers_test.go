@@ -0,0 +1,128 @@
+package runhttp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/settings/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServersRuntime(t *testing.T, servers map[string]http.Handler, env ...string) (*Runtime, error) {
+	env = append([]string{
+		"RUNTIME_HTTPSERVER_ADDRESS=127.0.0.1:0",
+		"RUNTIME_LOGGER_OUTPUT=NULL",
+	}, env...)
+	source, err := settings.NewEnvSource(env)
+	require.Nil(t, err)
+	rt, err := NewWithServers(context.Background(), source, http.NotFoundHandler(), servers)
+	if err != nil {
+		return nil, err
+	}
+	rt.Exit = make(chan error, 1)
+	t.Cleanup(func() { _ = rt.Close() })
+	return rt, nil
+}
+
+func TestRuntimeServers(t *testing.T) {
+	respond := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(body))
+		})
+	}
+	rt, err := newTestServersRuntime(t,
+		map[string]http.Handler{
+			"public":   respond("public"),
+			"internal": respond("internal"),
+		},
+		"RUNTIME_SERVERS_PUBLIC_ADDRESS=127.0.0.1:0",
+		"RUNTIME_SERVERS_INTERNAL_ADDRESS=127.0.0.1:0",
+	)
+	require.Nil(t, err)
+	require.Len(t, rt.Servers, 2)
+	require.NotNil(t, rt.Servers["public"].ConnState)
+	require.NotEqual(t, rt.ConnState, rt.Servers["public"].ConnState)
+	require.NotEqual(t, rt.Servers["public"].ConnState, rt.Servers["internal"].ConnState)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+	<-rt.Ready()
+	require.Nil(t, rt.ServerAddr("missing"))
+	for _, name := range []string{"public", "internal"} {
+		addr := rt.ServerAddr(name)
+		require.NotNil(t, addr, name)
+		require.NotEqual(t, rt.Addr().String(), addr.String())
+		resp, err := http.Get("http://" + addr.String())
+		require.Nil(t, err, name)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err)
+		require.Equal(t, name, string(body))
+	}
+	resp, err := http.Get("http://" + rt.Addr().String())
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	rt.Exit <- nil
+	require.Nil(t, <-done)
+	require.Nil(t, rt.ServerAddr("public"))
+	require.Nil(t, rt.ServerAddr("internal"))
+}
+
+func TestRuntimeServersInvalid(t *testing.T) {
+	// A named server has no default address.
+	_, err := newTestServersRuntime(t, map[string]http.Handler{"public": http.NotFoundHandler()})
+	require.NotNil(t, err)
+
+	_, err = newTestServersRuntime(t,
+		map[string]http.Handler{"public_api": http.NotFoundHandler()},
+		"RUNTIME_SERVERS_PUBLIC_API_ADDRESS=127.0.0.1:0",
+	)
+	require.NotNil(t, err)
+}
+
+func TestComponentServersRequireNewWithServers(t *testing.T) {
+	cmp := NewComponent().WithServers(map[string]http.Handler{"public": http.NotFoundHandler()})
+	_, err := cmp.New(context.Background(), cmp.Settings())
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "NewWithServers")
+}
+
+func TestRuntimeServersConfig(t *testing.T) {
+	rt, err := newTestServersRuntime(t,
+		map[string]http.Handler{"public": http.NotFoundHandler()},
+		"RUNTIME_SERVERS_PUBLIC_ADDRESS=127.0.0.1:0",
+		"RUNTIME_SERVERS_PUBLIC_TLS_RELOADINTERVAL=0s",
+		"RUNTIME_ADMIN_ENABLED=true",
+		"RUNTIME_ADMIN_ADDRESS=127.0.0.1:0",
+	)
+	require.Nil(t, err)
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.Run()
+	}()
+	<-rt.Ready()
+
+	resp, err := http.Get("http://" + rt.AdminAddr().String() + "/config")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	var conf struct {
+		HTTP    *HTTPConfig
+		Servers map[string]*HTTPConfig
+	}
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&conf))
+	require.Equal(t, "127.0.0.1:0", conf.HTTP.Address)
+	require.Contains(t, conf.Servers, "public")
+	require.Equal(t, "127.0.0.1:0", conf.Servers["public"].Address)
+	require.Equal(t, time.Duration(0), conf.Servers["public"].TLS.ReloadInterval)
+
+	rt.Exit <- nil
+	require.Nil(t, <-done)
+}
@@ -0,0 +1,209 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statTimerShutdownPreDrain   = "http.server.shutdown.predrain"
+	statTimerShutdownDrain      = "http.server.shutdown.drain"
+	statTimerRestartDrain       = "http.server.restart.drain"
+	defaultShutdownPreDrain     = 0
+	defaultShutdownDrainTimeout = 30 * time.Second
+)
+
+type logShutdownStarted struct {
+	PreDrainDelay string `logevent:"pre_drain_delay"`
+	DrainTimeout  string `logevent:"drain_timeout"`
+	Message       string `logevent:"message,default=shutdown-started"`
+}
+
+type logShutdownDraining struct {
+	Message string `logevent:"message,default=shutdown-draining"`
+}
+
+type logShutdownForced struct {
+	Reason  string `logevent:"reason"`
+	Message string `logevent:"message,default=shutdown-forced"`
+}
+
+type logShutdownComplete struct {
+	Message string `logevent:"message,default=shutdown-complete"`
+}
+
+// ShutdownConfig is the container for graceful shutdown settings.
+type ShutdownConfig struct {
+	PreDrainDelay     time.Duration `description:"Time to keep serving traffic, while reporting not ready, after a shutdown signal."`
+	DrainTimeout      time.Duration `description:"Maximum time to wait for in-flight requests before connections are forcibly closed."`
+	PreDrainTimer     string        `description:"Name of the timing metric tracking the pre-drain phase."`
+	DrainTimer        string        `description:"Name of the timing metric tracking the drain phase."`
+	RestartDrainTimer string        `description:"Name of the timing metric tracking the drain of a server replaced by a restart."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*ShutdownConfig) Name() string {
+	return "shutdown"
+}
+
+// Description returns the help information for the configuration root.
+func (*ShutdownConfig) Description() string {
+	return "Graceful shutdown configuration."
+}
+
+// Shutdown describes the phases a Runtime moves through after a shutdown
+// signal. During the pre-drain delay the server continues to handle
+// requests but the health check reports it as unavailable so that load
+// balancers can stop routing to it. The server then stops accepting
+// connections and waits up to the drain timeout for in-flight requests
+// before closing any remaining connections. A server replaced by a restart
+// is drained with the same timeout.
+type Shutdown struct {
+	PreDrainDelay         time.Duration
+	DrainTimeout          time.Duration
+	PreDrainTimerName     string
+	DrainTimerName        string
+	RestartDrainTimerName string
+}
+
+// ShutdownComponent implements the settings.Component interface for
+// graceful shutdown.
+type ShutdownComponent struct{}
+
+// Settings returns a configuration with all defaults set.
+func (*ShutdownComponent) Settings() *ShutdownConfig {
+	return &ShutdownConfig{
+		PreDrainDelay:     defaultShutdownPreDrain,
+		DrainTimeout:      defaultShutdownDrainTimeout,
+		PreDrainTimer:     statTimerShutdownPreDrain,
+		DrainTimer:        statTimerShutdownDrain,
+		RestartDrainTimer: statTimerRestartDrain,
+	}
+}
+
+// New produces a Shutdown bound to the given configuration.
+func (*ShutdownComponent) New(_ context.Context, conf *ShutdownConfig) (*Shutdown, error) {
+	if conf.PreDrainDelay < 0 {
+		return nil, fmt.Errorf("shutdown predraindelay must not be negative but was %s", conf.PreDrainDelay)
+	}
+	if conf.DrainTimeout <= 0 {
+		return nil, fmt.Errorf("shutdown draintimeout must be positive but was %s", conf.DrainTimeout)
+	}
+	return &Shutdown{
+		PreDrainDelay:         conf.PreDrainDelay,
+		DrainTimeout:          conf.DrainTimeout,
+		PreDrainTimerName:     conf.PreDrainTimer,
+		DrainTimerName:        conf.DrainTimer,
+		RestartDrainTimerName: conf.RestartDrainTimer,
+	}, nil
+}
+
+type drainingKey struct{}
+
+// withDraining exposes the draining state of a runtime to request handlers.
+func withDraining(draining *atomic.Bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), drainingKey{}, draining)))
+		})
+	}
+}
+
+// isDraining reports whether the runtime serving a request has begun to
+// shut down.
+func isDraining(ctx context.Context) bool {
+	draining, ok := ctx.Value(drainingKey{}).(*atomic.Bool)
+	return ok && draining.Load()
+}
+
+// shutdownPolicy returns the configured policy or the default.
+func (r *Runtime) shutdownPolicy() *Shutdown {
+	if r.Shutdown != nil {
+		return r.Shutdown
+	}
+	return &Shutdown{
+		DrainTimeout:          defaultShutdownDrainTimeout,
+		PreDrainTimerName:     statTimerShutdownPreDrain,
+		DrainTimerName:        statTimerShutdownDrain,
+		RestartDrainTimerName: statTimerRestartDrain,
+	}
+}
+
+// shutdown runs each phase of the shutdown policy against the servers. The
+// pre-drain phase is skipped when preDrain is false, such as when startup
+// is aborted before the server is announced as ready, and is cut short by
+// a second exit signal or when force is closed. The error of a second exit
+// signal is returned alongside any failure to drain.
+func (r *Runtime) shutdown(preDrain bool, force <-chan struct{}) error {
+	policy := r.shutdownPolicy()
+	r.draining.Store(true)
+	r.Logger.Info(logShutdownStarted{
+		PreDrainDelay: policy.PreDrainDelay.String(),
+		DrainTimeout:  policy.DrainTimeout.String(),
+	})
+	var signalErr error
+	if preDrain && policy.PreDrainDelay > 0 {
+		start := time.Now()
+		timer := time.NewTimer(policy.PreDrainDelay)
+		select {
+		case <-timer.C:
+		case signalErr = <-r.Exit:
+		case <-force:
+		}
+		timer.Stop()
+		r.Stats.Timing(policy.PreDrainTimerName, time.Since(start))
+	}
+
+	r.Logger.Info(logShutdownDraining{})
+	// New connections are refused from here on rather than left waiting
+	// for a server that will never accept them.
+	for _, inst := range r.instances {
+		if inst.listener != nil {
+			_ = inst.listener.Close()
+		}
+	}
+	errs := make(chan error, len(r.instances))
+	for _, inst := range r.instances {
+		go func(inst *instance) {
+			errs <- r.drain(inst.server, inst.cancel, policy.DrainTimerName)
+		}(inst)
+	}
+	var err error
+	for range r.instances {
+		err = errors.Join(err, <-errs)
+	}
+	// Servers replaced by a restart may still be draining.
+	r.replaced.Wait()
+	if err != nil {
+		return errors.Join(signalErr, err)
+	}
+	r.Logger.Info(logShutdownComplete{})
+	return signalErr
+}
+
+// drain stops the server from accepting connections and waits up to the
+// drain timeout for in-flight requests before closing their connections.
+// The duration of the drain is recorded by the named timer.
+func (r *Runtime) drain(server *http.Server, cancelRequests context.CancelFunc, timerName string) error {
+	policy := r.shutdownPolicy()
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), policy.DrainTimeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	r.Stats.Timing(timerName, time.Since(start))
+	// Any request still running has outlived the drain phase and is
+	// told to stop before its connection is closed.
+	if cancelRequests != nil {
+		cancelRequests()
+	}
+	if err != nil {
+		r.Logger.Warn(logShutdownForced{Reason: err.Error()})
+		_ = server.Close()
+		return fmt.Errorf("failed to drain connections within %s: %w", policy.DrainTimeout, err)
+	}
+	return nil
+}
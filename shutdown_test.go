@@ -0,0 +1,165 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownComponentValidation(t *testing.T) {
+	cmp := &ShutdownComponent{}
+	conf := cmp.Settings()
+	conf.PreDrainDelay = -time.Second
+	_, err := cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+
+	conf = cmp.Settings()
+	conf.DrainTimeout = 0
+	_, err = cmp.New(context.Background(), conf)
+	require.NotNil(t, err)
+}
+
+func TestRuntimeShutdownPreDrain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	rt := &Runtime{
+		Logger: logger,
+		Stats:  stat,
+		Shutdown: &Shutdown{
+			PreDrainDelay:     100 * time.Millisecond,
+			DrainTimeout:      time.Second,
+			PreDrainTimerName: "predrain",
+			DrainTimerName:    "drain",
+		},
+	}
+	srv := httptest.NewServer(withDraining(&rt.draining)(http.HandlerFunc((&HealthCheckHandler{}).Handle)))
+	defer srv.Close()
+	rt.instances = []*instance{{name: mainServerName, server: srv.Config}}
+
+	logger.EXPECT().Info(gomock.Any()).Times(3)
+	stat.EXPECT().Timing("predrain", gomock.Any())
+	stat.EXPECT().Timing("drain", gomock.Any())
+
+	resp, err := http.Get(srv.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	done := make(chan error)
+	go func() {
+		done <- rt.shutdown(true, nil)
+	}()
+	// The server continues to handle requests during the pre-drain phase
+	// but reports itself as unavailable.
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	require.Nil(t, <-done)
+}
+
+func TestRuntimeShutdownForced(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	logger := NewMockLogger(ctrl)
+	stat := NewMockStat(ctrl)
+	rt := &Runtime{
+		Logger: logger,
+		Stats:  stat,
+		Shutdown: &Shutdown{
+			DrainTimeout:      50 * time.Millisecond,
+			PreDrainTimerName: "predrain",
+			DrainTimerName:    "drain",
+		},
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	rt.instances = []*instance{{name: mainServerName, server: srv.Config}}
+
+	logger.EXPECT().Info(gomock.Any()).Times(2)
+	logger.EXPECT().Warn(gomock.Any())
+	stat.EXPECT().Timing("drain", gomock.Any())
+
+	go func() {
+		resp, err := http.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	err := rt.shutdown(true, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRuntimeShutdownPreDrainInterrupted(t *testing.T) {
+	exitErr := errors.New("second signal")
+	tests := []struct {
+		name      string
+		interrupt func(exit chan error, force chan struct{})
+		err       error
+	}{
+		{name: "second signal", interrupt: func(exit chan error, _ chan struct{}) { exit <- exitErr }, err: exitErr},
+		{name: "force", interrupt: func(_ chan error, force chan struct{}) { close(force) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logger := NewMockLogger(ctrl)
+			stat := NewMockStat(ctrl)
+			exit := make(chan error, 1)
+			rt := &Runtime{
+				Logger: logger,
+				Stats:  stat,
+				Exit:   exit,
+				Shutdown: &Shutdown{
+					PreDrainDelay:     time.Minute,
+					DrainTimeout:      time.Second,
+					PreDrainTimerName: "predrain",
+					DrainTimerName:    "drain",
+				},
+			}
+			srv := httptest.NewServer(http.NotFoundHandler())
+			defer srv.Close()
+			rt.instances = []*instance{{name: mainServerName, server: srv.Config}}
+
+			logger.EXPECT().Info(gomock.Any()).Times(3)
+			stat.EXPECT().Timing("predrain", gomock.Any())
+			stat.EXPECT().Timing("drain", gomock.Any())
+
+			force := make(chan struct{})
+			done := make(chan error)
+			go func() {
+				done <- rt.shutdown(true, force)
+			}()
+			tt.interrupt(exit, force)
+			select {
+			case err := <-done:
+				require.Equal(t, tt.err, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("the pre-drain phase was not cut short")
+			}
+		})
+	}
+}
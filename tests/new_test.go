@@ -43,7 +43,7 @@ func TestNew(t *testing.T) {
 	// these ENV vars are exactly the ones that users would set when running
 	// the system.
 	source, err := settings.NewEnvSource([]string{
-		"RUNTIME_HTTPSERVER_ADDRESS=localhost:9090",
+		"RUNTIME_HTTPSERVER_ADDRESS=localhost:0",
 		"RUNTIME_LOGGER_OUTPUT=NULL",
 		"RUNTIME_STATS_OUTPUT=DATADOG",
 		"RUNTIME_STATS_DATADOG_TAGS=foo:bar key:value",
@@ -58,6 +58,7 @@ func TestNew(t *testing.T) {
 	require.Nil(t, err)
 	rt, err := runhttp.New(ctx, source, handler)
 	require.Nil(t, err)
+	defer rt.Close()
 	// Swapping the NULL stat and logger so we can verify that the user
 	// choice is propagated into the handler by leveraging the mock
 	// expectations.
@@ -72,6 +73,9 @@ func TestNew(t *testing.T) {
 	// times as part of the test.
 	logger.EXPECT().Copy().Return(logger).MinTimes(1)
 	logger.EXPECT().Info(gomock.Any()).MinTimes(1)
+	logger.EXPECT().SetField("request_id", gomock.Any()).MinTimes(1)
+	logger.EXPECT().SetField("trace_id", gomock.Any()).MinTimes(1)
+	logger.EXPECT().SetField("span_id", gomock.Any()).MinTimes(1)
 	stat.EXPECT().Copy().Return(stat).AnyTimes()
 	stat.EXPECT().Count("test", float64(1)).MinTimes(1)
 	stat.EXPECT().Count("newcounter", float64(1)).MinTimes(1)
@@ -81,30 +85,23 @@ func TestNew(t *testing.T) {
 	stat.EXPECT().Count("newgauge", gomock.Any()).AnyTimes()
 	stat.EXPECT().Count("idlegauge", gomock.Any()).AnyTimes()
 	stat.EXPECT().Count("activegauge", gomock.Any(), []string{"foo:bar", "key:value"}).AnyTimes()
+	stat.EXPECT().Timing("http.server.shutdown.drain", gomock.Any()).Times(1)
 
 	exit := make(chan error)
 	go func() {
 		exit <- rt.Run()
 	}()
 
-	// Ping the server until it is available or until we exceed a timeout
-	// value. This is to account for arbitrary start-up time of the server
-	// in the background.
-	stop := time.Now().Add(5 * time.Second)
-	for time.Now().Before(stop) {
-		time.Sleep(100 * time.Millisecond)
-		resp, err := http.DefaultClient.Get("http://localhost:9090")
-		if err != nil {
-			t.Log(err.Error())
-			continue
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			t.Log(resp.StatusCode)
-			continue
-		}
-		break
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the server to start")
+	case <-rt.Ready():
 	}
+	resp, err := http.DefaultClient.Get("http://" + rt.Addr().String())
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
 	// The runtime establishes a signal handler for the entire
 	// process. This means we have the process signal itself and
 	// the runtime will intercept the call. This enables us to test
@@ -0,0 +1,207 @@
+package runhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	tlsVersion10 = "1.0"
+	tlsVersion11 = "1.1"
+	tlsVersion12 = "1.2"
+	tlsVersion13 = "1.3"
+
+	// CipherProfileDefault uses the cipher suites selected by the Go runtime.
+	CipherProfileDefault = "DEFAULT"
+	// CipherProfileModern limits TLS 1.2 connections to forward secret AEAD
+	// cipher suites. TLS 1.3 suites are not configurable and are always enabled.
+	CipherProfileModern = "MODERN"
+	// CipherProfileCompatible enables every cipher suite that the Go runtime
+	// does not consider insecure, including CBC modes, for older clients.
+	CipherProfileCompatible = "COMPATIBLE"
+
+	// ClientAuthNone does not request a client certificate.
+	ClientAuthNone = "NONE"
+	// ClientAuthRequest requests, but does not require or verify, a client
+	// certificate.
+	ClientAuthRequest = "REQUEST"
+	// ClientAuthRequire requires, but does not verify, a client certificate.
+	ClientAuthRequire = "REQUIRE"
+	// ClientAuthVerifyIfGiven verifies a client certificate when one is sent.
+	ClientAuthVerifyIfGiven = "VERIFYIFGIVEN"
+	// ClientAuthRequireAndVerify requires and verifies a client certificate.
+	ClientAuthRequireAndVerify = "REQUIREANDVERIFY"
+
+	defaultTLSMinVersion    = tlsVersion12
+	defaultTLSCipherProfile = CipherProfileDefault
+	defaultTLSClientAuth    = ClientAuthNone
+)
+
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// TLSConfig is the container for TLS and mutual TLS settings.
+type TLSConfig struct {
+	CertFile      string `description:"Path to a PEM encoded certificate chain. TLS is disabled when empty."`
+	KeyFile       string `description:"Path to the PEM encoded private key for the certificate."`
+	MinVersion    string `description:"The minimum accepted TLS version. One of 1.0, 1.1, 1.2, 1.3."`
+	CipherProfile string `description:"The set of TLS 1.2 cipher suites to allow. One of DEFAULT, MODERN, COMPATIBLE."`
+	ClientCAFile  string `description:"Path to a PEM encoded CA bundle used to verify client certificates."`
+	ClientAuth    string `description:"Client certificate policy. One of NONE, REQUEST, REQUIRE, VERIFYIFGIVEN, REQUIREANDVERIFY."`
+	// Hot reload settings are applied by the runtime rather than the
+	// TLSComponent because reloading requires a logger and stat client.
+	ReloadInterval      time.Duration `description:"Interval on which the certificate and key files are checked for changes. Zero disables reloading."`
+	ReloadCounter       string        `description:"Name of the counter metric tracking certificate reloads."`
+	ReloadFailedCounter string        `description:"Name of the counter metric tracking failed certificate reloads."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*TLSConfig) Name() string {
+	return "tls"
+}
+
+// Description returns the help information for the configuration root.
+func (*TLSConfig) Description() string {
+	return "TLS server configuration."
+}
+
+// Enabled reports whether the configuration requests a TLS listener. A nil
+// configuration does not.
+func (c *TLSConfig) Enabled() bool {
+	return c != nil && (c.CertFile != "" || c.KeyFile != "")
+}
+
+// TLSComponent implements the settings.Component interface for server TLS.
+type TLSComponent struct{}
+
+// Settings returns a configuration with all defaults set.
+func (*TLSComponent) Settings() *TLSConfig {
+	return &TLSConfig{
+		MinVersion:    defaultTLSMinVersion,
+		CipherProfile: defaultTLSCipherProfile,
+		ClientAuth:    defaultTLSClientAuth,
+
+		ReloadInterval:      defaultCertificateReloadInterval,
+		ReloadCounter:       statCounterCertificateReload,
+		ReloadFailedCounter: statCounterCertificateReloadFailure,
+	}
+}
+
+// New produces a *tls.Config bound to the given configuration. The result
+// is nil when TLS is not enabled.
+func (*TLSComponent) New(_ context.Context, conf *TLSConfig) (*tls.Config, error) {
+	if !conf.Enabled() {
+		return nil, nil
+	}
+	if conf.CertFile == "" || conf.KeyFile == "" {
+		return nil, fmt.Errorf("tls requires both a certificate and key file")
+	}
+	if conf.ReloadInterval < 0 {
+		return nil, fmt.Errorf("tls reloadinterval must not be negative but was %s", conf.ReloadInterval)
+	}
+	minVersion, err := tlsVersion(conf.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	ciphers, err := tlsCipherSuites(conf.CipherProfile)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := tlsClientAuth(conf.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls key pair: %s", err.Error())
+	}
+	result := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		CipherSuites: ciphers,
+		ClientAuth:   clientAuth,
+	}
+	if conf.ClientCAFile != "" {
+		result.ClientCAs, err = loadCertPool(conf.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if clientAuth >= tls.VerifyClientCertIfGiven && result.ClientCAs == nil {
+		return nil, fmt.Errorf("tls client auth %s requires a client CA file", conf.ClientAuth)
+	}
+	return result, nil
+}
+
+func tlsVersion(v string) (uint16, error) {
+	switch v {
+	case tlsVersion10:
+		return tls.VersionTLS10, nil
+	case tlsVersion11:
+		return tls.VersionTLS11, nil
+	case tlsVersion12:
+		return tls.VersionTLS12, nil
+	case tlsVersion13:
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown tls version %s", v)
+	}
+}
+
+func tlsCipherSuites(profile string) ([]uint16, error) {
+	switch {
+	case strings.EqualFold(profile, CipherProfileDefault):
+		return nil, nil
+	case strings.EqualFold(profile, CipherProfileModern):
+		return modernCipherSuites, nil
+	case strings.EqualFold(profile, CipherProfileCompatible):
+		suites := tls.CipherSuites()
+		ids := make([]uint16, 0, len(suites))
+		for _, suite := range suites {
+			ids = append(ids, suite.ID)
+		}
+		return ids, nil
+	default:
+		return nil, fmt.Errorf("unknown tls cipher profile %s", profile)
+	}
+}
+
+func tlsClientAuth(auth string) (tls.ClientAuthType, error) {
+	switch {
+	case strings.EqualFold(auth, ClientAuthNone):
+		return tls.NoClientCert, nil
+	case strings.EqualFold(auth, ClientAuthRequest):
+		return tls.RequestClientCert, nil
+	case strings.EqualFold(auth, ClientAuthRequire):
+		return tls.RequireAnyClientCert, nil
+	case strings.EqualFold(auth, ClientAuthVerifyIfGiven):
+		return tls.VerifyClientCertIfGiven, nil
+	case strings.EqualFold(auth, ClientAuthRequireAndVerify):
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown tls client auth %s", auth)
+	}
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %s", err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no PEM certificates found in CA file %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,154 @@
+package runhttp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	CertFile string
+	KeyFile  string
+	Cert     *x509.Certificate
+	Key      *ecdsa.PrivateKey
+}
+
+// newTestCert writes a PEM encoded certificate and key to dir. The
+// certificate is self-signed when parent is nil.
+func newTestCert(t *testing.T, dir string, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	result := &testCert{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+		Cert:     cert,
+		Key:      key,
+	}
+	require.Nil(t, os.WriteFile(result.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, os.WriteFile(result.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return result
+}
+
+func TestTLSComponentDisabled(t *testing.T) {
+	cmp := &TLSComponent{}
+	conf, err := cmp.New(context.Background(), cmp.Settings())
+	require.Nil(t, err)
+	require.Nil(t, conf)
+
+	conf, err = cmp.New(context.Background(), nil)
+	require.Nil(t, err)
+	require.Nil(t, conf)
+}
+
+func TestTLSComponentErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	server := newTestCert(t, dir, "server", ca)
+	tests := []struct {
+		name   string
+		modify func(*TLSConfig)
+	}{
+		{name: "missing key", modify: func(c *TLSConfig) { c.KeyFile = "" }},
+		{name: "missing cert file", modify: func(c *TLSConfig) { c.CertFile = filepath.Join(dir, "missing.crt") }},
+		{name: "bad version", modify: func(c *TLSConfig) { c.MinVersion = "2.0" }},
+		{name: "bad cipher profile", modify: func(c *TLSConfig) { c.CipherProfile = "FAST" }},
+		{name: "bad client auth", modify: func(c *TLSConfig) { c.ClientAuth = "SOMETIMES" }},
+		{name: "verify without ca", modify: func(c *TLSConfig) { c.ClientAuth = ClientAuthRequireAndVerify }},
+		{name: "bad ca file", modify: func(c *TLSConfig) { c.ClientCAFile = server.KeyFile }},
+		{name: "negative reload interval", modify: func(c *TLSConfig) { c.ReloadInterval = -time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmp := &TLSComponent{}
+			conf := cmp.Settings()
+			conf.CertFile = server.CertFile
+			conf.KeyFile = server.KeyFile
+			tt.modify(conf)
+			_, err := cmp.New(context.Background(), conf)
+			require.NotNil(t, err)
+		})
+	}
+}
+
+func TestTLSComponentMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	server := newTestCert(t, dir, "server", ca)
+	client := newTestCert(t, dir, "client", ca)
+
+	cmp := &TLSComponent{}
+	conf := cmp.Settings()
+	conf.CertFile = server.CertFile
+	conf.KeyFile = server.KeyFile
+	conf.ClientCAFile = ca.CertFile
+	conf.ClientAuth = ClientAuthRequireAndVerify
+	conf.CipherProfile = CipherProfileModern
+	tlsConf, err := cmp.New(context.Background(), conf)
+	require.Nil(t, err)
+	require.Equal(t, uint16(tls.VersionTLS12), tlsConf.MinVersion)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = tlsConf
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	clientPair, err := tls.LoadX509KeyPair(client.CertFile, client.KeyFile)
+	require.Nil(t, err)
+
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	_, err = anonymous.Get(srv.URL)
+	require.NotNil(t, err)
+
+	authenticated := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientPair},
+	}}}
+	resp, err := authenticated.Get(srv.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,298 @@
+package runhttp
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	headerTraceParent   = "Traceparent"
+	headerTraceState    = "Tracestate"
+	headerTraceResponse = "Traceresponse"
+
+	traceParentVersion = "00"
+	traceFlagSampled   = 0x01
+	// maxTraceStateLength is the longest tracestate header that is
+	// propagated. Longer values are dropped as the specification allows.
+	maxTraceStateLength = 512
+
+	// SpanKindServer is the kind of a span that records a request handled
+	// by a Runtime.
+	SpanKindServer = "SERVER"
+
+	traceIDLogField = "trace_id"
+	spanIDLogField  = "span_id"
+)
+
+// TraceID is the W3C trace context identifier of a trace.
+type TraceID [16]byte
+
+// String returns the ID as lowercase hex.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the ID has a non-zero value.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID is the W3C trace context identifier of a span.
+type SpanID [8]byte
+
+// String returns the ID as lowercase hex.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the ID has a non-zero value.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// Span is a timed operation within a trace. The ParentID is not valid for
+// the root span of a trace. Attributes follow the OpenTelemetry semantic
+// conventions for HTTP servers, such as http.route and
+// http.response.status_code.
+type Span struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	TraceState string
+	Sampled    bool
+	Name       string
+	Kind       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+	Error      bool
+}
+
+// traceParent renders the traceparent header that makes this span the
+// parent of the receiver. The traceresponse header has the same format.
+func (s *Span) traceParent() string {
+	var flags byte
+	if s.Sampled {
+		flags |= traceFlagSampled
+	}
+	return fmt.Sprintf("%s-%s-%s-%02x", traceParentVersion, s.TraceID, s.SpanID, flags)
+}
+
+// SpanExporter sends finished spans to a tracing backend.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+}
+
+// spanBatcher is implemented by exporters, such as the BatchExporter,
+// that queue spans and send them in the background.
+type spanBatcher interface {
+	SpanExporter
+	Run()
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+// Tracer records a server span for each request. The trace is continued
+// from valid traceparent and tracestate headers of the request and
+// otherwise a new trace is started. The span is available to handlers
+// through TraceFromContext and the trace and span IDs are added as the
+// trace_id and span_id fields of the logger in the request context.
+// Sampled spans are sent to the Exporter, if set, once the request
+// completes.
+//
+// The IDs of the span are only returned to the caller, in the
+// traceresponse header, if TraceResponse is set because they identify
+// the internal spans of the service.
+//
+// A continued trace keeps the sampling decision of the caller. A new trace
+// is sampled with a probability of SampleRate so that every span of a
+// trace is either recorded or not. A service at the edge should set
+// IgnoreParentSampled so that untrusted callers cannot force their
+// requests to be sampled. Continued traces are then also sampled with a
+// probability of SampleRate.
+type Tracer struct {
+	Exporter            SpanExporter
+	SampleRate          float64
+	IgnoreParentSampled bool
+	TraceResponse       bool
+}
+
+// Run sends spans in the background until Close is called if the Exporter
+// queues spans. Otherwise it returns immediately.
+func (tr *Tracer) Run() {
+	if batcher, ok := tr.Exporter.(spanBatcher); ok {
+		batcher.Run()
+	}
+}
+
+// Flush sends any spans queued by the Exporter.
+func (tr *Tracer) Flush(ctx context.Context) error {
+	if batcher, ok := tr.Exporter.(spanBatcher); ok {
+		return batcher.Flush(ctx)
+	}
+	return nil
+}
+
+// Close stops any background sends of the Exporter and sends the spans
+// that remain queued.
+func (tr *Tracer) Close() error {
+	if batcher, ok := tr.Exporter.(spanBatcher); ok {
+		return batcher.Close()
+	}
+	return nil
+}
+
+// Middleware wraps a handler so that each of its requests is traced.
+func (tr *Tracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := tr.startSpan(r)
+		logger := LoggerFromContext(r.Context())
+		logger.SetField(traceIDLogField, span.TraceID.String())
+		logger.SetField(spanIDLogField, span.SpanID.String())
+		if tr.TraceResponse {
+			w.Header().Set(headerTraceResponse, span.traceParent())
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), traceKey{}, span)))
+
+		span.End = time.Now()
+		status := responseStatus(ww)
+		route := routePattern(r)
+		if route != "" {
+			span.Name = r.Method + " " + route
+			span.Attributes["http.route"] = route
+		}
+		span.Attributes["http.response.status_code"] = strconv.Itoa(status)
+		span.Error = status >= http.StatusInternalServerError
+		if span.Sampled && tr.Exporter != nil {
+			_ = tr.Exporter.ExportSpans(context.WithoutCancel(r.Context()), []*Span{span})
+		}
+	})
+}
+
+// startSpan creates the server span of a request.
+func (tr *Tracer) startSpan(r *http.Request) *Span {
+	span := &Span{
+		SpanID: newSpanID(),
+		Name:   r.Method,
+		Kind:   SpanKindServer,
+		Start:  time.Now(),
+		Attributes: map[string]string{
+			"http.request.method": r.Method,
+			"url.path":            r.URL.Path,
+		},
+	}
+	if traceID, parentID, flags, ok := parseTraceParent(r.Header.Get(headerTraceParent)); ok {
+		span.TraceID = traceID
+		span.ParentID = parentID
+		span.Sampled = flags&traceFlagSampled != 0
+		if tr.IgnoreParentSampled {
+			span.Sampled = tr.sample()
+		}
+		if state := strings.Join(r.Header.Values(headerTraceState), ","); len(state) <= maxTraceStateLength {
+			span.TraceState = state
+		}
+		return span
+	}
+	span.TraceID = newTraceID()
+	span.Sampled = tr.sample()
+	return span
+}
+
+// sample decides whether a trace is sampled with a probability of
+// SampleRate.
+func (tr *Tracer) sample() bool {
+	return tr.SampleRate >= 1 || rand.Float64() < tr.SampleRate
+}
+
+// parseTraceParent parses a traceparent header. Versions other than 00
+// are parsed as 00, as the specification requires, and must be followed
+// by the same fields.
+func parseTraceParent(value string) (TraceID, SpanID, byte, bool) {
+	var traceID TraceID
+	var parentID SpanID
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, 0, false
+	}
+	if parts[0] == "ff" || (parts[0] == traceParentVersion && len(parts) != 4) {
+		return traceID, parentID, 0, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || !isLowerHex(parts[1]) {
+		return traceID, parentID, 0, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || !isLowerHex(parts[2]) {
+		return traceID, parentID, 0, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil || !isLowerHex(parts[0]+parts[3]) {
+		return traceID, parentID, 0, false
+	}
+	if !traceID.IsValid() || !parentID.IsValid() {
+		return traceID, parentID, 0, false
+	}
+	return traceID, parentID, flags[0], true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		for offset := range id {
+			id[offset] = byte(rand.Uint32())
+		}
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		for offset := range id {
+			id[offset] = byte(rand.Uint32())
+		}
+	}
+	return id
+}
+
+type traceKey struct{}
+
+// TraceFromContext returns the span of the request being served or nil if
+// the request is not traced.
+func TraceFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(traceKey{}).(*Span)
+	return span
+}
+
+// InjectTrace sets the traceparent and tracestate headers of an outbound
+// request so that the receiving service continues the trace of the
+// request being served. The headers are left unchanged if ctx has no span.
+func InjectTrace(ctx context.Context, header http.Header) {
+	span := TraceFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(headerTraceParent, span.traceParent())
+	if span.TraceState != "" {
+		header.Set(headerTraceState, span.TraceState)
+	} else {
+		header.Del(headerTraceState)
+	}
+}
@@ -0,0 +1,199 @@
+package runhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) ExportSpans(_ context.Context, spans []*Span) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) recorded() []*Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+func TestTracer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	exporter := &recordingExporter{}
+	tracer := &Tracer{Exporter: exporter, SampleRate: 1}
+
+	var seen *Span
+	router := chi.NewRouter()
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		seen = TraceFromContext(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	handler := withRouteContext(router)(tracer.Middleware(router))
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	logger.EXPECT().SetField(traceIDLogField, "4bf92f3577b34da6a3ce929d0e0e4736")
+	logger.EXPECT().SetField(spanIDLogField, gomock.Any())
+	r := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	r.Header.Set("traceparent", parent)
+	r.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	r = r.WithContext(logevent.NewContext(r.Context(), logger))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	require.NotNil(t, seen)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", seen.TraceID.String())
+	require.Equal(t, "00f067aa0ba902b7", seen.ParentID.String())
+	require.NotEqual(t, seen.ParentID, seen.SpanID)
+	require.True(t, seen.Sampled)
+	require.Equal(t, "GET /users/{id}", seen.Name)
+	require.Equal(t, SpanKindServer, seen.Kind)
+	require.Equal(t, "/users/{id}", seen.Attributes["http.route"])
+	require.Equal(t, "500", seen.Attributes["http.response.status_code"])
+	require.True(t, seen.Error)
+	require.False(t, seen.End.Before(seen.Start))
+	require.Empty(t, w.Header().Get("traceparent"))
+	require.Empty(t, w.Header().Get("tracestate"))
+	require.Empty(t, w.Header().Get("traceresponse"))
+	require.Equal(t, []*Span{seen}, exporter.recorded())
+}
+
+func TestTracerNewTrace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	logger.EXPECT().SetField(gomock.Any(), gomock.Any()).AnyTimes()
+	exporter := &recordingExporter{}
+	tracer := &Tracer{Exporter: exporter, SampleRate: 1}
+
+	var seen *Span
+	handler := tracer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = TraceFromContext(r.Context())
+	}))
+	tc := []struct {
+		name   string
+		parent string
+	}{
+		{name: "missing"},
+		{name: "zero trace id", parent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero parent id", parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "uppercase", parent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "invalid version", parent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "trailing data", parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "short", parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+	}
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.parent != "" {
+				r.Header.Set("traceparent", tt.parent)
+			}
+			r.Header.Set("tracestate", "congo=t61rcWkgMzE")
+			r = r.WithContext(logevent.NewContext(r.Context(), logger))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.NotNil(t, seen)
+			require.True(t, seen.TraceID.IsValid())
+			require.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", seen.TraceID.String())
+			require.False(t, seen.ParentID.IsValid())
+			require.True(t, seen.Sampled)
+			require.Equal(t, "", seen.TraceState)
+			require.Equal(t, "GET", seen.Name)
+			require.Equal(t, "200", seen.Attributes["http.response.status_code"])
+			require.Equal(t, "", w.Header().Get("tracestate"))
+		})
+	}
+	require.Len(t, exporter.recorded(), len(tc))
+}
+
+func TestTracerFutureVersion(t *testing.T) {
+	traceID, parentID, flags, ok := parseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	require.True(t, ok)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID.String())
+	require.Equal(t, "00f067aa0ba902b7", parentID.String())
+	require.Equal(t, byte(traceFlagSampled), flags)
+}
+
+func TestTracerNotSampled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	logger.EXPECT().SetField(gomock.Any(), gomock.Any()).AnyTimes()
+	exporter := &recordingExporter{}
+	tracer := &Tracer{Exporter: exporter, SampleRate: 1, TraceResponse: true}
+	handler := tracer.Middleware(http.NotFoundHandler())
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	r = r.WithContext(logevent.NewContext(r.Context(), logger))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Empty(t, exporter.recorded())
+	require.Regexp(t, "^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-00$", w.Header().Get("traceresponse"))
+}
+
+func TestTracerIgnoreParentSampled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	logger := NewMockLogger(ctrl)
+	logger.EXPECT().SetField(gomock.Any(), gomock.Any()).AnyTimes()
+	exporter := &recordingExporter{}
+	tracer := &Tracer{Exporter: exporter, SampleRate: 0, IgnoreParentSampled: true}
+
+	var seen *Span
+	handler := tracer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = TraceFromContext(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r = r.WithContext(logevent.NewContext(r.Context(), logger))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.NotNil(t, seen)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", seen.TraceID.String())
+	require.False(t, seen.Sampled)
+	require.Empty(t, exporter.recorded())
+
+	tracer.SampleRate = 1
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	r = r.WithContext(logevent.NewContext(r.Context(), logger))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.True(t, seen.Sampled)
+	require.Len(t, exporter.recorded(), 1)
+}
+
+func TestInjectTrace(t *testing.T) {
+	header := http.Header{}
+	InjectTrace(context.Background(), header)
+	require.Empty(t, header)
+
+	span := &Span{
+		TraceID:    TraceID{1},
+		SpanID:     SpanID{2},
+		Sampled:    true,
+		TraceState: "congo=t61rcWkgMzE",
+	}
+	header.Set("tracestate", "stale=1")
+	InjectTrace(context.WithValue(context.Background(), traceKey{}, span), header)
+	require.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", header.Get("traceparent"))
+	require.Equal(t, "congo=t61rcWkgMzE", header.Get("tracestate"))
+}
+
+func TestTraceFromContextEmpty(t *testing.T) {
+	require.Nil(t, TraceFromContext(context.Background()))
+}
@@ -0,0 +1,255 @@
+package runhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// envUpgradeListenerFDs lists the file descriptors of the listeners
+	// handed to a process started by an upgrade as name=fd pairs
+	// separated by commas.
+	envUpgradeListenerFDs = "RUNHTTP_UPGRADE_LISTENER_FDS"
+	// envUpgradeReadyFD names the file descriptor to which a process
+	// started by an upgrade writes once it is ready.
+	envUpgradeReadyFD = "RUNHTTP_UPGRADE_READY_FD"
+
+	defaultUpgradeReadyTimeout = time.Minute
+)
+
+type logUpgradeStarted struct {
+	PID     int    `logevent:"pid"`
+	Message string `logevent:"message,default=upgrade-started"`
+}
+
+type logUpgradeFailed struct {
+	Reason  string `logevent:"reason"`
+	Message string `logevent:"message,default=upgrade-failed"`
+}
+
+type logUpgradeComplete struct {
+	PID     int    `logevent:"pid"`
+	Message string `logevent:"message,default=upgrade-complete"`
+}
+
+// UpgradeConfig is the container for binary upgrade settings.
+type UpgradeConfig struct {
+	Signals      []int         `description:"Which OS signals start a binary upgrade, such as 12 for SIGUSR2 on Linux. Empty disables upgrades."`
+	ReadyTimeout time.Duration `description:"Maximum time to wait for the new process to become ready before the upgrade is abandoned."`
+}
+
+// Name returns the configuration root as it would appear in a config file.
+func (*UpgradeConfig) Name() string {
+	return "upgrade"
+}
+
+// Description returns the help information for the configuration root.
+func (*UpgradeConfig) Description() string {
+	return "Zero-downtime binary upgrade configuration."
+}
+
+// Upgrade describes how a Runtime hands its listeners to a new copy of the
+// running binary. On each value received from Signal the binary is started
+// again with the listeners passed as inherited file descriptors. Once the
+// new process reports that it is ready the current process shuts down as
+// though it received an exit signal. If the new process fails or does not
+// become ready within the ReadyTimeout then it is killed and the current
+// process continues to serve.
+type Upgrade struct {
+	Signal       <-chan os.Signal
+	ReadyTimeout time.Duration
+}
+
+// UpgradeComponent implements the settings.Component interface for binary
+// upgrades.
+type UpgradeComponent struct{}
+
+// Settings returns a configuration with all defaults set.
+func (*UpgradeComponent) Settings() *UpgradeConfig {
+	return &UpgradeConfig{
+		ReadyTimeout: defaultUpgradeReadyTimeout,
+	}
+}
+
+// New produces an Upgrade bound to the given configuration. The result is
+// nil when no upgrade signals are configured.
+func (*UpgradeComponent) New(_ context.Context, conf *UpgradeConfig) (*Upgrade, error) {
+	if len(conf.Signals) < 1 {
+		return nil, nil
+	}
+	if conf.ReadyTimeout <= 0 {
+		return nil, fmt.Errorf("upgrade readytimeout must be positive but was %s", conf.ReadyTimeout)
+	}
+	sigs := make([]os.Signal, 0, len(conf.Signals))
+	for _, sig := range conf.Signals {
+		sigs = append(sigs, syscall.Signal(sig))
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	return &Upgrade{
+		Signal:       c,
+		ReadyTimeout: conf.ReadyTimeout,
+	}, nil
+}
+
+// upgradeSignal returns the channel of upgrade signals or nil, which is
+// never ready, when upgrades are disabled.
+func (r *Runtime) upgradeSignal() <-chan os.Signal {
+	if r.Upgrade == nil {
+		return nil
+	}
+	return r.Upgrade.Signal
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// upgrade starts a new copy of the running binary that shares the
+// listeners of every server and waits for it to become ready. A nil error
+// means the new process is serving and this one should shut down.
+func (r *Runtime) upgrade() error {
+	err := r.startUpgrade()
+	if err != nil {
+		r.Logger.Error(logUpgradeFailed{Reason: err.Error()})
+	}
+	return err
+}
+
+func (r *Runtime) startUpgrade() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// Each entry of ExtraFiles becomes descriptor 3+i in the new process.
+	files := make([]*os.File, 0, len(r.instances)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	fds := make([]string, 0, len(r.instances))
+	for _, inst := range r.instances {
+		l, ok := inst.listener.Listener.(filer)
+		if !ok {
+			return fmt.Errorf("listener of type %T cannot be passed to another process", inst.listener.Listener)
+		}
+		var f *os.File
+		f, err = l.File()
+		if err != nil {
+			return err
+		}
+		fds = append(fds, fmt.Sprintf("%s=%d", inst.name, 3+len(files)))
+		files = append(files, f)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(
+		os.Environ(),
+		envUpgradeListenerFDs+"="+strings.Join(fds, ","),
+		fmt.Sprintf("%s=%d", envUpgradeReadyFD, 3+len(files)),
+	)
+	err = cmd.Start()
+	// The write end must be closed here so that the read below ends if
+	// the new process exits before it reports ready.
+	_ = readyW.Close()
+	if err != nil {
+		return err
+	}
+	r.Logger.Info(logUpgradeStarted{PID: cmd.Process.Pid})
+
+	ready := make(chan error, 1)
+	go func() {
+		_, readErr := readyR.Read(make([]byte, 1))
+		ready <- readErr
+	}()
+	timer := time.NewTimer(r.Upgrade.ReadyTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+	case <-timer.C:
+		err = fmt.Errorf("new process was not ready within %s", r.Upgrade.ReadyTimeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("new process %d failed to start: %w", cmd.Process.Pid, err)
+	}
+	// The new process now owns the sockets so closing the listeners here
+	// must not remove a unix socket file from under it.
+	for _, inst := range r.instances {
+		if ul, ok := inst.listener.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	_ = cmd.Process.Release()
+	r.Logger.Info(logUpgradeComplete{PID: cmd.Process.Pid})
+	return nil
+}
+
+// inheritedListeners returns the file descriptors of the listeners handed
+// to this process by an upgrade, keyed by server name. The result is empty
+// if the process was not started by an upgrade. The environment is only
+// read once so that every run of the process listens on the same sockets.
+var inheritedListeners = sync.OnceValues(readInheritedListeners)
+
+func readInheritedListeners() (map[string]int, error) {
+	value, ok := os.LookupEnv(envUpgradeListenerFDs)
+	if !ok {
+		return nil, nil
+	}
+	// The variable is removed so that it does not leak into any process
+	// started by this one.
+	_ = os.Unsetenv(envUpgradeListenerFDs)
+	fds := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		name, fd, found := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(fd)
+		if !found || err != nil {
+			return nil, fmt.Errorf("inherited listener %q is not a named file descriptor", pair)
+		}
+		fds[name] = n
+	}
+	return fds, nil
+}
+
+// notifyUpgradeReady tells the process that started this one through an
+// upgrade that it may shut down. It does nothing if the process was not
+// started by an upgrade.
+func notifyUpgradeReady() error {
+	value, ok := os.LookupEnv(envUpgradeReadyFD)
+	if !ok {
+		return nil
+	}
+	_ = os.Unsetenv(envUpgradeReadyFD)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("upgrade ready notification %q is not a file descriptor", value)
+	}
+	f := os.NewFile(uintptr(fd), envUpgradeReadyFD)
+	if f == nil {
+		return errors.New("upgrade ready notification is not a valid file descriptor")
+	}
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
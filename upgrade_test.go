@@ -0,0 +1,127 @@
+//go:build linux
+
+package runhttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/settings/v2"
+	"github.com/stretchr/testify/require"
+)
+
+const envUpgradeHelper = "RUNHTTP_TEST_UPGRADE_HELPER"
+
+// TestUpgradeHelperProcess is not a real test. It is the server process
+// started by TestUpgrade and, through the upgrade, the process that
+// replaces it. Each responds to requests with its process ID.
+func TestUpgradeHelperProcess(t *testing.T) {
+	if os.Getenv(envUpgradeHelper) != "1" {
+		t.Skip("only run as a helper process")
+	}
+	// Only the original process reports its address. The output of the
+	// replacement is closed once the original exits and writing to it
+	// would kill the process.
+	_, upgraded := os.LookupEnv(envUpgradeListenerFDs)
+	source, err := settings.NewEnvSource([]string{
+		"RUNTIME_HTTPSERVER_ADDRESS=127.0.0.1:0",
+		"RUNTIME_LOGGER_OUTPUT=NULL",
+		fmt.Sprintf("RUNTIME_UPGRADE_SIGNALS=%d", int(syscall.SIGUSR2)),
+	})
+	if err != nil {
+		os.Exit(2)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strconv.Itoa(os.Getpid())))
+	})
+	rt, err := New(context.Background(), source, handler)
+	if err != nil {
+		os.Exit(2)
+	}
+	go func() {
+		<-rt.Ready()
+		if !upgraded {
+			fmt.Println(rt.Addr().String())
+		}
+	}()
+	if err := rt.Run(); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func getPID(t *testing.T, addr string) (int, error) {
+	t.Helper()
+	// Each request uses a new connection so that it is not sent over an
+	// idle connection to a process that has since exited.
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://" + addr)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(body))
+}
+
+func TestUpgrade(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeHelperProcess$")
+	cmd.Env = append(os.Environ(), envUpgradeHelper+"=1")
+	stdout, err := cmd.StdoutPipe()
+	require.Nil(t, err)
+	require.Nil(t, cmd.Start())
+	parent := cmd.Process.Pid
+	defer func() { _ = cmd.Process.Kill() }()
+
+	lines := make(chan string, 2)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	var addr string
+	select {
+	case addr = <-lines:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the server to start")
+	}
+	pid, err := getPID(t, addr)
+	require.Nil(t, err)
+	require.Equal(t, parent, pid)
+
+	require.Nil(t, cmd.Process.Signal(syscall.SIGUSR2))
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err = <-exited:
+		require.Nil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the original process to exit")
+	}
+
+	// The replacement serves on the same address after the original
+	// process has exited.
+	child, err := getPID(t, addr)
+	require.Nil(t, err)
+	require.NotEqual(t, parent, child)
+	require.Nil(t, syscall.Kill(child, syscall.SIGTERM))
+	require.Eventually(t, func() bool {
+		_, err := getPID(t, addr)
+		return err != nil
+	}, 10*time.Second, 50*time.Millisecond)
+}